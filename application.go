@@ -0,0 +1,188 @@
+package alphaBroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	ErrComponentExists  = errors.New("component already registered")
+	ErrUnknownComponent = errors.New("unknown component")
+	ErrDependencyCycle  = errors.New("component dependency cycle")
+	ErrLaunchFailed     = errors.New("component launch failed")
+	ErrAlreadyStarted   = errors.New("application already started")
+)
+
+// Starter is implemented by components whose launch can fail, the
+// Application calls Start instead of Launch for them.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+type registration struct {
+	name      string
+	component Component
+	deps      []string
+}
+
+// Application launches registered components in dependency order and
+// stops them in reverse order.
+type Application struct {
+	conf ApplicationConfig
+
+	mu      sync.Mutex
+	regs    map[string]*registration
+	names   []string // registration order, keeps the launch order stable
+	started []*registration
+	running bool
+}
+
+func NewApplication(conf ApplicationConfig) *Application {
+	conf.defaults()
+	return &Application{
+		conf: conf,
+		regs: make(map[string]*registration),
+	}
+}
+
+// Register adds a component launched after the components named in deps.
+func (a *Application) Register(name string, c Component, deps ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.regs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrComponentExists, name)
+	}
+	a.regs[name] = &registration{name: name, component: c, deps: deps}
+	a.names = append(a.names, name)
+	return nil
+}
+
+func (a *Application) Component(name string) (Component, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reg, ok := a.regs[name]
+	if !ok {
+		return nil, false
+	}
+	return reg.component, true
+}
+
+// order sorts the registrations so that every component follows its dependencies.
+func (a *Application) order() ([]*registration, error) {
+	indegree := make(map[string]int, len(a.regs))
+	dependents := make(map[string][]string, len(a.regs))
+	for _, name := range a.names {
+		reg := a.regs[name]
+		for _, dep := range reg.deps {
+			if _, ok := a.regs[dep]; !ok {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrUnknownComponent, name, dep)
+			}
+			indegree[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	var queue []string
+	for _, name := range a.names {
+		if indegree[name] == 0 {
+			queue = append(queue, name)
+		}
+	}
+	sorted := make([]*registration, 0, len(a.names))
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		sorted = append(sorted, a.regs[name])
+		for _, dependent := range dependents[name] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	if len(sorted) != len(a.names) {
+		return nil, ErrDependencyCycle
+	}
+	return sorted, nil
+}
+
+// Start launches the components in dependency order, the components already
+// launched are stopped again within StopTimeout when one of them fails. It
+// returns ErrAlreadyStarted until the started application is stopped.
+func (a *Application) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return ErrAlreadyStarted
+	}
+	sorted, err := a.order()
+	if err != nil {
+		return err
+	}
+	for _, reg := range sorted {
+		if err = launch(ctx, reg.component); err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrLaunchFailed, reg.name, err)
+			// ctx may be the one cancelled by a signal, the rollback
+			// still drains what was started
+			stopCtx, cancel := context.WithTimeout(context.Background(), a.conf.StopTimeout)
+			defer cancel()
+			return errors.Join(err, a.stopStarted(stopCtx))
+		}
+		a.started = append(a.started, reg)
+	}
+	a.running = true
+	return nil
+}
+
+func launch(ctx context.Context, c Component) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+	if s, ok := c.(Starter); ok {
+		return s.Start(ctx)
+	}
+	c.Launch()
+	if c.State() == StateStopped {
+		return ErrComponentStopped
+	}
+	return nil
+}
+
+// Stop stops the launched components in reverse launch order.
+func (a *Application) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopStarted(ctx)
+}
+
+func (a *Application) stopStarted(ctx context.Context) error {
+	var errs []error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		reg := a.started[i]
+		if err := reg.component.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", reg.name, err))
+		}
+	}
+	a.started, a.running = nil, false
+	return errors.Join(errs...)
+}
+
+// Run starts the application, waits for SIGINT, SIGTERM or the end of ctx
+// and stops it within the configured StopTimeout.
+func (a *Application) Run(ctx context.Context) error {
+	sigCtx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if err := a.Start(sigCtx); err != nil {
+		return err
+	}
+	<-sigCtx.Done()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), a.conf.StopTimeout)
+	defer stopCancel()
+	return a.Stop(stopCtx)
+}
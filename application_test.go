@@ -0,0 +1,122 @@
+package alphaBroker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type recordComponent struct {
+	*BaseComponent
+	name string
+	log  *[]string
+	err  error
+
+	onStart func()
+}
+
+func (r *recordComponent) Start(ctx context.Context) error {
+	if r.onStart != nil {
+		r.onStart()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	*r.log = append(*r.log, "start "+r.name)
+	r.Launch()
+	return nil
+}
+
+func (r *recordComponent) Stop(ctx context.Context) error {
+	*r.log = append(*r.log, "stop "+r.name)
+	return r.BaseComponent.Stop(ctx)
+}
+
+func TestApplication(t *testing.T) {
+	var log []string
+	newComponent := func(name string, err error) *recordComponent {
+		return &recordComponent{BaseComponent: NewBaseComponent(), name: name, log: &log, err: err}
+	}
+	app := NewApplication(ApplicationConfig{})
+	app.Register("api", newComponent("api", nil), "mongo", "nsq")
+	app.Register("nsq", newComponent("nsq", nil))
+	app.Register("mongo", newComponent("mongo", nil), "nsq")
+	if err := app.Register("nsq", newComponent("nsq", nil)); !errors.Is(err, ErrComponentExists) {
+		t.Fatalf("got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := app.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start nsq", "start mongo", "start api", "stop api", "stop mongo", "stop nsq"}
+	if len(log) != len(want) {
+		t.Fatalf("got %v", log)
+	}
+	for i := range want {
+		if log[i] != want[i] {
+			t.Fatalf("got %v", log)
+		}
+	}
+
+	// a second Start neither launches nor stops the components twice
+	log = nil
+	app = NewApplication(ApplicationConfig{})
+	app.Register("nsq", newComponent("nsq", nil))
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Start(context.Background()); !errors.Is(err, ErrAlreadyStarted) {
+		t.Fatalf("got %v", err)
+	}
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start nsq", "stop nsq"}; len(log) != 2 || log[0] != want[0] || log[1] != want[1] {
+		t.Fatalf("got %v", log)
+	}
+
+	log = nil
+	errBoom := errors.New("boom")
+	app = NewApplication(ApplicationConfig{})
+	app.Register("nsq", newComponent("nsq", nil))
+	app.Register("mongo", newComponent("mongo", errBoom), "nsq")
+	if err := app.Start(context.Background()); !errors.Is(err, ErrLaunchFailed) || !errors.Is(err, errBoom) {
+		t.Fatalf("got %v", err)
+	}
+	if len(log) != 2 || log[1] != "stop nsq" {
+		t.Fatalf("got %v", log)
+	}
+
+	// a signal during startup does not cut the rollback short
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	nsq := newComponent("nsq", nil)
+	mongo := newComponent("mongo", errBoom)
+	var inflight *Future[int]
+	mongo.onStart = func() {
+		inflight = Submit(context.Background(), nsq, func(ctx context.Context) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			return 1, nil
+		})
+		cancel()
+	}
+	app = NewApplication(ApplicationConfig{})
+	app.Register("nsq", nsq)
+	app.Register("mongo", mongo, "nsq")
+	if err := app.Start(ctx); !errors.Is(err, errBoom) || errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+	if v, err := inflight.Wait(context.Background()); err != nil || v != 1 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+
+	app = NewApplication(ApplicationConfig{})
+	app.Register("a", newComponent("a", nil), "b")
+	app.Register("b", newComponent("b", nil), "a")
+	if err := app.Start(context.Background()); !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("got %v", err)
+	}
+}
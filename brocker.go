@@ -1,54 +1,285 @@
 package alphaBroker
 
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrComponentStopped  = errors.New("component stopped")
+	ErrComponentDraining = errors.New("component draining")
+)
+
+type State int32
+
+const (
+	StateCreated State = iota
+	StateRunning
+	StateDraining
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Component is an event loop resolving operations. Launch and Stop are
+// idempotent, Stop returns once the queued operations are drained or ctx ends.
 type Component interface {
 	Resolve(opCh Operation)
 	Launch()
-	Stop()
+	Stop(ctx context.Context) error
+	State() State
 }
 
 type BaseComponent struct {
-	stopCh chan struct{}
-	opCh   chan Operation
+	conf ComponentConfig
+
+	mu      sync.RWMutex
+	state   State
+	pending sync.WaitGroup // Resolve calls handing an operation to the mailbox
+
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	mailbox *mailbox
+	pool    *workerPool
 }
 
 func NewBaseComponent() *BaseComponent {
+	return NewBaseComponentWithConfig(ComponentConfig{})
+}
+
+func NewBaseComponentWithConfig(conf ComponentConfig) *BaseComponent {
+	conf.defaults()
 	return &BaseComponent{
-		stopCh: make(chan struct{}),
-		opCh:   make(chan Operation),
+		conf:    conf,
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+		mailbox: newMailbox(conf.Mailbox),
+		pool:    newWorkerPool(conf.Pool),
 	}
 }
 
+func (b *BaseComponent) State() State {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state
+}
+
+// Resolve queues the operation in the mailbox, operations resolved while the
+// component drains, after it stopped or rejected by the mailbox are
+// completed with an error.
 func (b *BaseComponent) Resolve(op Operation) {
-	b.opCh <- op
+	b.mu.RLock()
+	switch b.state {
+	case StateDraining:
+		b.mu.RUnlock()
+		op.fail(ErrComponentDraining)
+		return
+	case StateStopped:
+		b.mu.RUnlock()
+		op.fail(ErrComponentStopped)
+		return
+	}
+	b.pending.Add(1)
+	b.mu.RUnlock()
+	defer b.pending.Done()
+
+	if err := b.mailbox.push(op); err != nil {
+		op.fail(err)
+	}
+}
+
+func (b *BaseComponent) MailboxStats() MailboxStats {
+	return b.mailbox.stats()
+}
+
+func (b *BaseComponent) PoolStats() PoolStats {
+	return b.pool.stats()
 }
 
 func (b *BaseComponent) Launch() {
-	go func() {
-		for {
-			select {
-			case <-b.stopCh:
-				return
-			case op := <-b.opCh:
-				b.dealOp(op)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateCreated {
+		return
+	}
+	b.state = StateRunning
+	b.pool.start()
+	go b.supervise()
+}
+
+func (b *BaseComponent) Stop(ctx context.Context) error {
+	var rejected []Operation
+	b.mu.Lock()
+	switch b.state {
+	case StateCreated:
+		b.state = StateStopped
+		rejected = b.mailbox.close()
+		b.pool.stop()
+		close(b.doneCh)
+	case StateRunning:
+		b.state = StateDraining
+		close(b.stopCh)
+	}
+	b.mu.Unlock()
+	b.reject(rejected)
+
+	select {
+	case <-b.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// supervise runs the loop and restarts it according to the supervisor
+// policy, the component is stopped once the restart budget is spent.
+func (b *BaseComponent) supervise() {
+	defer func() {
+		b.mu.Lock()
+		b.state = StateStopped
+		b.mu.Unlock()
+		b.reject(b.mailbox.close())
+		b.pool.stop()
+		close(b.doneCh)
+	}()
+	policy := &b.conf.Supervisor
+	s := &supervisor{policy: policy}
+	for {
+		perr := b.loop()
+		if perr == nil {
+			return
+		}
+		backoff, ok := s.next(time.Now())
+		if !ok {
+			return
+		}
+		select {
+		case <-b.stopCh:
+			b.drain()
+			return
+		case <-time.After(backoff):
+		}
+		if policy.OnRestart != nil {
+			policy.OnRestart(len(s.restarts))
+		}
+	}
+}
+
+// loop returns nil when stopped, or the panic that should restart it.
+func (b *BaseComponent) loop() (perr *PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr = newPanicError(r)
+			b.conf.Supervisor.report(perr)
+		}
+	}()
+	for {
+		select {
+		case <-b.stopCh:
+			b.drain()
+			return nil
+		default:
+		}
+		if op, ok := b.mailbox.pop(); ok {
+			if perr := b.dealOp(op); perr != nil && b.conf.Supervisor.Strategy != RestartNone {
+				return perr
 			}
+			continue
+		}
+		select {
+		case <-b.stopCh:
+			b.drain()
+			return nil
+		case <-b.mailbox.notEmpty:
 		}
+	}
+}
+
+// drain deals with the operations resolved before Stop, then waits for the
+// asynchronous operations queued in the pool.
+func (b *BaseComponent) drain() {
+	sendersDone := make(chan struct{})
+	go func() {
+		b.pending.Wait()
+		close(sendersDone)
 	}()
+	for {
+		if op, ok := b.mailbox.pop(); ok {
+			b.drainOp(op)
+			continue
+		}
+		select {
+		case <-b.mailbox.notEmpty:
+		case <-sendersDone:
+			for op, ok := b.mailbox.pop(); ok; op, ok = b.mailbox.pop() {
+				b.drainOp(op)
+			}
+			b.pool.stop()
+			return
+		}
+	}
 }
 
-func (b *BaseComponent) Stop() {
-	b.stopCh <- struct{}{}
+func (b *BaseComponent) drainOp(op Operation) {
+	if b.conf.Drain == DrainReject {
+		op.fail(ErrComponentDraining)
+		return
+	}
+	b.dealOp(op)
 }
 
-func (b *BaseComponent) dealOp(operation Operation) {
-	fn := func() {
-		operation.Cb()
-		operation.Ret <- struct{}{}
+func (b *BaseComponent) reject(ops []Operation) {
+	for _, op := range ops {
+		op.fail(ErrComponentStopped)
 	}
+}
+
+func (b *BaseComponent) dealOp(operation Operation) *PanicError {
 	if !operation.IsAsynchronous {
-		fn()
-	} else {
-		go func() {
-			fn()
+		return b.execute(operation)
+	}
+	err := b.pool.submit(operation.Key, func() {
+		b.execute(operation)
+	})
+	if err != nil {
+		operation.fail(err)
+	}
+	return nil
+}
+
+// execute runs the operation, a panic is recovered and reported to the
+// caller as a *PanicError.
+func (b *BaseComponent) execute(operation Operation) (perr *PanicError) {
+	var (
+		v   interface{}
+		err error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				perr = newPanicError(r)
+				err = perr
+			}
 		}()
+		v, err = operation.run()
+	}()
+	if perr != nil {
+		b.conf.Supervisor.report(perr)
 	}
+	operation.finish(v, err)
+	return perr
 }
@@ -0,0 +1,438 @@
+package alphaBroker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFuture(t *testing.T) {
+	b := NewBaseComponent()
+	b.Launch()
+	defer b.Stop(context.Background())
+
+	f := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	v, err := f.Wait(context.Background())
+	if err != nil || v != 42 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+
+	errBoom := errors.New("boom")
+	f = Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 0, errBoom
+	})
+	if _, err = f.Wait(context.Background()); !errors.Is(err, errBoom) {
+		t.Fatalf("got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	f = Submit(ctx, b, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if _, err = f.Wait(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestLegacyOperation(t *testing.T) {
+	b := NewBaseComponent()
+	b.Launch()
+	defer b.Stop(context.Background())
+
+	called := false
+	op := Operation{
+		Cb:  func() { called = true },
+		Ret: make(chan interface{}),
+	}
+	b.Resolve(op)
+	if ret := <-op.Ret; ret != struct{}{} || !called {
+		t.Fatalf("got %v, called %v", ret, called)
+	}
+}
+
+// recvRet reads the legacy Ret of an operation, failing if Resolve blocked
+// on it or nothing is delivered.
+func recvRet(t *testing.T, resolve func(), ret chan interface{}) interface{} {
+	t.Helper()
+	resolved := make(chan struct{})
+	go func() {
+		resolve()
+		close(resolved)
+	}()
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatal("Resolve blocked on Ret")
+	}
+	select {
+	case v := <-ret:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("nothing delivered to Ret")
+	}
+	return nil
+}
+
+func TestLegacyOperationStopped(t *testing.T) {
+	b := NewBaseComponent()
+	b.Launch()
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	op := Operation{Cb: func() {}, Ret: make(chan interface{})}
+	if ret := recvRet(t, func() { b.Resolve(op) }, op.Ret); ret != ErrComponentStopped {
+		t.Fatalf("got %v", ret)
+	}
+}
+
+func TestLegacyOperationRejected(t *testing.T) {
+	// Stop does not wait for the callers of the operations it rejects
+	b := NewBaseComponent()
+	queued := Operation{Cb: func() {}, Ret: make(chan interface{})}
+	b.Resolve(queued)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ret := <-queued.Ret; ret != ErrComponentStopped {
+		t.Fatalf("got %v", ret)
+	}
+
+	b = NewBaseComponentWithConfig(ComponentConfig{Drain: DrainReject})
+	b.Launch()
+	started, release := make(chan struct{}), make(chan struct{})
+	b.Resolve(Operation{Cb: func() {
+		close(started)
+		<-release
+	}})
+	<-started
+	queued = Operation{Cb: func() {}, Ret: make(chan interface{})}
+	b.Resolve(queued)
+	stopped := make(chan error)
+	go func() { stopped <- b.Stop(context.Background()) }()
+	for b.State() != StateDraining {
+		time.Sleep(time.Millisecond)
+	}
+	op := Operation{Cb: func() {}, Ret: make(chan interface{})}
+	if ret := recvRet(t, func() { b.Resolve(op) }, op.Ret); ret != ErrComponentDraining {
+		t.Fatalf("got %v", ret)
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if ret := <-queued.Ret; ret != ErrComponentDraining {
+		t.Fatalf("got %v", ret)
+	}
+}
+
+func TestPanicIsolation(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Supervisor: SupervisorPolicy{OnPanic: func(*PanicError) {}},
+	})
+	b.Launch()
+	defer b.Stop(context.Background())
+
+	f := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+	var perr *PanicError
+	if _, err := f.Wait(context.Background()); !errors.As(err, &perr) || perr.Value != "boom" || len(perr.Stack) == 0 {
+		t.Fatalf("got %v", err)
+	}
+
+	op := Operation{Cb: func() { panic("legacy") }, Ret: make(chan interface{})}
+	b.Resolve(op)
+	if ret := <-op.Ret; !errors.As(ret.(error), &perr) {
+		t.Fatalf("got %v", ret)
+	}
+
+	f = Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	if v, err := f.Wait(context.Background()); err != nil || v != 1 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	restarts := 0
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Supervisor: SupervisorPolicy{
+			Strategy:    RestartOneForOne,
+			MaxRestarts: 2,
+			Backoff:     time.Millisecond,
+			OnPanic:     func(*PanicError) {},
+			OnRestart:   func(n int) { restarts = n },
+		},
+	})
+	b.Launch()
+
+	boom := func(ctx context.Context) (int, error) { panic("boom") }
+	for i := 0; i < 3; i++ {
+		if _, err := Submit(context.Background(), b, boom).Wait(context.Background()); err == nil {
+			t.Fatal("expected panic error")
+		}
+	}
+	_, err := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 1, nil
+	}).Wait(context.Background())
+	if !errors.Is(err, ErrComponentStopped) || restarts != 2 {
+		t.Fatalf("got %v after %d restarts", err, restarts)
+	}
+	b.Stop(context.Background())
+}
+
+func TestLifecycle(t *testing.T) {
+	b := NewBaseComponent()
+	if err := b.Stop(context.Background()); err != nil || b.State() != StateStopped {
+		t.Fatalf("got %v, %v", err, b.State())
+	}
+	b.Launch()
+	if b.State() != StateStopped {
+		t.Fatalf("got %v", b.State())
+	}
+	_, err := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 1, nil
+	}).Wait(context.Background())
+	if !errors.Is(err, ErrComponentStopped) {
+		t.Fatalf("got %v", err)
+	}
+
+	b = NewBaseComponent()
+	b.Launch()
+	b.Launch()
+	if b.State() != StateRunning {
+		t.Fatalf("got %v", b.State())
+	}
+	release := make(chan struct{})
+	first := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+	queued := make(chan *Future[int], 3)
+	for i := 0; i < cap(queued); i++ {
+		go func() {
+			queued <- Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+				return 1, nil
+			})
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	stopped := make(chan error)
+	go func() { stopped <- b.Stop(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	if b.State() != StateDraining {
+		t.Fatalf("got %v", b.State())
+	}
+	_, err = Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 1, nil
+	}).Wait(context.Background())
+	if !errors.Is(err, ErrComponentDraining) {
+		t.Fatalf("got %v", err)
+	}
+	close(release)
+	if err = <-stopped; err != nil || b.State() != StateStopped {
+		t.Fatalf("got %v, %v", err, b.State())
+	}
+	if _, err = first.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cap(queued); i++ {
+		if v, err := (<-queued).Wait(context.Background()); err != nil || v != 1 {
+			t.Fatalf("got %v, %v", v, err)
+		}
+	}
+	if err = b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainReject(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{Drain: DrainReject})
+	b.Launch()
+	release := make(chan struct{})
+	Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+	queued := make(chan *Future[int])
+	go func() {
+		queued <- Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+	close(release)
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (<-queued).Wait(context.Background()); !errors.Is(err, ErrComponentDraining) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMailbox(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Mailbox: MailboxConfig{Size: 2, Overflow: OverflowReject},
+	})
+	var order []int
+	resolve := func(i int, p Priority) *Future[int] {
+		op, f := NewOperation(context.Background(), func(ctx context.Context) (int, error) {
+			order = append(order, i)
+			return i, nil
+		})
+		op.Priority = p
+		b.Resolve(op)
+		return f
+	}
+	resolve(1, PriorityNormal)
+	resolve(2, PriorityNormal)
+	if _, err := resolve(3, PriorityNormal).Wait(context.Background()); !errors.Is(err, ErrMailboxFull) {
+		t.Fatalf("got %v", err)
+	}
+	last := resolve(4, PriorityHigh)
+	stats := b.MailboxStats()
+	if stats.NormalDepth != 2 || stats.HighDepth != 1 || stats.Rejected != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	b.Launch()
+	defer b.Stop(context.Background())
+	if _, err := last.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != 4 || order[1] != 1 || order[2] != 2 {
+		t.Fatalf("got %v", order)
+	}
+}
+
+func TestMailboxDropOldest(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Mailbox: MailboxConfig{Size: 1, Overflow: OverflowDropOldest},
+	})
+	first := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	second := Submit(context.Background(), b, func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+	if _, err := first.Wait(context.Background()); !errors.Is(err, ErrMailboxDropped) {
+		t.Fatalf("got %v", err)
+	}
+	b.Launch()
+	if v, err := second.Wait(context.Background()); err != nil || v != 2 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+	if stats := b.MailboxStats(); stats.Dropped != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	b.Stop(context.Background())
+}
+
+func TestMailboxLegacyOperation(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Mailbox: MailboxConfig{Size: 1, Overflow: OverflowReject},
+	})
+	b.Resolve(Operation{Cb: func() {}})
+	op := Operation{Cb: func() {}, Ret: make(chan interface{})}
+	if ret := recvRet(t, func() { b.Resolve(op) }, op.Ret); ret != ErrMailboxFull {
+		t.Fatalf("got %v", ret)
+	}
+
+	b = NewBaseComponentWithConfig(ComponentConfig{
+		Mailbox: MailboxConfig{Size: 1, Overflow: OverflowDropOldest},
+	})
+	op = Operation{Cb: func() {}, Ret: make(chan interface{})}
+	b.Resolve(op)
+	if ret := recvRet(t, func() { b.Resolve(Operation{Cb: func() {}}) }, op.Ret); ret != ErrMailboxDropped {
+		t.Fatalf("got %v", ret)
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Pool: PoolConfig{MaxWorkers: 2, QueueSize: 1},
+	})
+	b.Launch()
+	defer b.Stop(context.Background())
+
+	resolve := func(fn func(ctx context.Context) (int, error)) *Future[int] {
+		op, f := NewOperation(context.Background(), fn)
+		op.IsAsynchronous = true
+		b.Resolve(op)
+		return f
+	}
+	release := make(chan struct{})
+	blocking := func(ctx context.Context) (int, error) {
+		<-release
+		return 0, nil
+	}
+	for i := 1; i <= 2; i++ {
+		resolve(blocking)
+		for b.PoolStats().Busy != i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	queued := resolve(blocking)
+	for b.PoolStats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := resolve(blocking).Wait(context.Background()); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("got %v", err)
+	}
+	if stats := b.PoolStats(); stats.Workers != 2 || stats.Rejected != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	close(release)
+	if _, err := queued.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerPoolKey(t *testing.T) {
+	b := NewBaseComponentWithConfig(ComponentConfig{
+		Pool: PoolConfig{MaxWorkers: 4, QueueSize: 64},
+	})
+	b.Launch()
+
+	var order []int
+	var futures []*Future[int]
+	for i := 0; i < 50; i++ {
+		i := i
+		op, f := NewOperation(context.Background(), func(ctx context.Context) (int, error) {
+			order = append(order, i)
+			return i, nil
+		})
+		op.IsAsynchronous = true
+		op.Key = "player"
+		b.Resolve(op)
+		futures = append(futures, f)
+	}
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range futures {
+		if v, err := f.Wait(context.Background()); err != nil || v != i || order[i] != i {
+			t.Fatalf("got %v, %v, order %v", v, err, order)
+		}
+	}
+	if stats := b.PoolStats(); stats.Completed != 50 {
+		t.Fatalf("got %+v", stats)
+	}
+}
@@ -0,0 +1,212 @@
+// Package cdc forwards the changes of MongoDB collections to NSQ topics.
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"github.com/AlphaMinZ/alpha_broker/mongo"
+	"github.com/AlphaMinZ/alpha_broker/nsq"
+	gonsq "github.com/nsqio/go-nsq"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultTopic             = "{{.Database}}.{{.Collection}}.{{.Operation}}"
+	DefaultCheckpointKey     = "cdc"
+	DefaultPublishBackoff    = 500 * time.Millisecond
+	DefaultPublishMaxBackoff = 30 * time.Second
+)
+
+// Format is how an event is serialized in the message body.
+type Format int
+
+const (
+	// FormatJSON is the relaxed extended JSON of the event.
+	FormatJSON Format = iota
+	// FormatBSON is the event as received from the change stream.
+	FormatBSON
+)
+
+// TopicData is what the Topic template of a BridgeConfig is executed with.
+// Collection is empty for the events of a whole database, like dropDatabase.
+type TopicData struct {
+	Database   string
+	Collection string
+	Operation  string
+}
+
+type BridgeConfig struct {
+	// Namespaces are the databases and collections watched, the whole
+	// deployment when empty.
+	Namespaces     []mongo.Namespace
+	OperationTypes []mongo.OperationType
+
+	// Topic is the text/template of the topic an event is published to,
+	// DefaultTopic when empty. An event the template renders no valid NSQ
+	// topic for is logged and skipped.
+	Topic  string
+	Format Format
+
+	// Category is the nsq.Manager category publishing the events, unless
+	// Publisher is set.
+	Category  string
+	Publisher nsq.Publisher
+
+	// Checkpoint keeps the resume token under CheckpointKey. Without it
+	// the bridge watches from the current time whenever it starts, and the
+	// changes made while it was stopped are not published.
+	Checkpoint    mongo.CheckpointStore
+	CheckpointKey string
+
+	// PublishBackoff is the first delay before publishing a failed event
+	// again, doubled up to PublishMaxBackoff. A failed event is retried
+	// until the bridge stops, the resume token never passes it.
+	PublishBackoff    time.Duration
+	PublishMaxBackoff time.Duration
+}
+
+func (c *BridgeConfig) defaults() {
+	if c.Topic == "" {
+		c.Topic = DefaultTopic
+	}
+	if c.Publisher == nil {
+		c.Publisher = &nsq.CategoryPublisher{Category: c.Category}
+	}
+	if c.CheckpointKey == "" {
+		c.CheckpointKey = DefaultCheckpointKey
+	}
+	if c.PublishBackoff <= 0 {
+		c.PublishBackoff = DefaultPublishBackoff
+	}
+	if c.PublishMaxBackoff < c.PublishBackoff {
+		c.PublishMaxBackoff = DefaultPublishMaxBackoff
+	}
+}
+
+// Bridge publishes every change of the watched namespaces to NSQ. The
+// resume token is saved once the publish of an event is acknowledged, so
+// an event is published at least once.
+type Bridge struct {
+	*alphaBroker.Runner
+	conf   BridgeConfig
+	client *driver.Client
+	stream *mongo.ChangeStream
+	topic  *template.Template
+	// open opens the change streams instead of client when set
+	open func(ctx context.Context, opts *options.ChangeStreamOptions) (mongo.ChangeCursor, error)
+}
+
+func NewBridge(client *driver.Client, conf BridgeConfig) (*Bridge, error) {
+	conf.defaults()
+	topic, err := template.New("topic").Option("missingkey=error").Parse(conf.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("cdc topic: %w", err)
+	}
+	stream := mongo.NewChangeStream()
+	stream.SetNamespaces(conf.Namespaces...)
+	stream.SetOperationTypes(conf.OperationTypes...)
+	if conf.Checkpoint != nil {
+		stream.SetCheckpoint(conf.Checkpoint, conf.CheckpointKey)
+	}
+	b := &Bridge{
+		conf:   conf,
+		client: client,
+		stream: stream,
+		topic:  topic,
+	}
+	b.Runner = alphaBroker.NewRunner("cdc bridge", b.run)
+	return b, nil
+}
+
+// run watches until ctx ends, the bridge has started once the first stream
+// is open: a checkpoint that cannot be loaded or a stream that cannot be
+// opened fails Start. Stopping gives up the event being published, the next
+// run publishes it again.
+func (b *Bridge) run(ctx context.Context, started func(error)) error {
+	b.stream.SetOnOpen(started)
+	if b.open != nil {
+		return b.stream.WatchRawOpen(ctx, b.open, b.handle)
+	}
+	return b.stream.WatchRaw(ctx, b.client, b.handle)
+}
+
+// header is the part of an event the topic depends on.
+type header struct {
+	OperationType mongo.OperationType `bson:"operationType"`
+	Namespace     mongo.Namespace     `bson:"ns"`
+}
+
+func (b *Bridge) handle(ctx context.Context, event bson.Raw) error {
+	var h header
+	if err := bson.Unmarshal(event, &h); err != nil {
+		return fmt.Errorf("cdc: decode event: %w", err)
+	}
+	topic, err := b.topicOf(h)
+	if err != nil {
+		// retrying cannot fix the topic of this event, skipping it keeps
+		// the bridge publishing the events that follow
+		log.Printf("%v, skipping event %s", err, event.Lookup("_id"))
+		return nil
+	}
+	body, err := b.encode(event)
+	if err != nil {
+		return err
+	}
+	return b.publish(ctx, topic, body)
+}
+
+func (b *Bridge) topicOf(h header) (string, error) {
+	var sb strings.Builder
+	data := TopicData{
+		Database:   h.Namespace.DB,
+		Collection: h.Namespace.Coll,
+		Operation:  string(h.OperationType),
+	}
+	if err := b.topic.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("cdc topic: %w", err)
+	}
+	topic := sb.String()
+	if !gonsq.IsValidTopicName(topic) {
+		return "", fmt.Errorf("cdc topic: invalid topic %q for %s on %s", topic, h.OperationType, h.Namespace)
+	}
+	return topic, nil
+}
+
+func (b *Bridge) encode(event bson.Raw) ([]byte, error) {
+	switch b.conf.Format {
+	case FormatBSON:
+		return event, nil
+	case FormatJSON:
+		body, err := bson.MarshalExtJSON(event, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("cdc: encode event: %w", err)
+		}
+		return body, nil
+	}
+	return nil, fmt.Errorf("cdc: unknown format %d", b.conf.Format)
+}
+
+// publish retries until the message is acknowledged or ctx ends.
+func (b *Bridge) publish(ctx context.Context, topic string, body []byte) error {
+	for failures := 1; ; failures++ {
+		err := b.conf.Publisher.Publish(topic, body)
+		if err == nil {
+			return nil
+		}
+		backoff := alphaBroker.Backoff(b.conf.PublishBackoff, b.conf.PublishMaxBackoff, failures)
+		log.Printf("cdc publish to %q: %v, retrying in %v", topic, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
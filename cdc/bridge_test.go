@@ -0,0 +1,223 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"github.com/AlphaMinZ/alpha_broker/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type publisherFunc func(topic string, body []byte) error
+
+func (f publisherFunc) Publish(topic string, body []byte) error {
+	return f(topic, body)
+}
+
+type message struct {
+	topic string
+	body  []byte
+}
+
+func event(t *testing.T, op, db, coll string) bson.Raw {
+	return eventID(t, "1", op, db, coll)
+}
+
+func eventID(t *testing.T, id, op, db, coll string) bson.Raw {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: id}}},
+		{Key: "operationType", Value: op},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: db}, {Key: "coll", Value: coll}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: 7}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func newTestBridge(t *testing.T, conf BridgeConfig) (*Bridge, *[]message) {
+	var sent []message
+	if conf.Publisher == nil {
+		conf.Publisher = publisherFunc(func(topic string, body []byte) error {
+			sent = append(sent, message{topic, body})
+			return nil
+		})
+	}
+	b, err := NewBridge(nil, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, &sent
+}
+
+func TestBridgeTopic(t *testing.T) {
+	b, sent := newTestBridge(t, BridgeConfig{})
+	if err := b.handle(context.Background(), event(t, "insert", "app", "orders")); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_id":{"_data":"1"},"operationType":"insert","ns":{"db":"app","coll":"orders"},"documentKey":{"_id":7}}`
+	if len(*sent) != 1 || (*sent)[0].topic != "app.orders.insert" || string((*sent)[0].body) != want {
+		t.Fatalf("got %q", *sent)
+	}
+
+	b, sent = newTestBridge(t, BridgeConfig{Topic: "cdc_{{.Collection}}", Format: FormatBSON})
+	raw := event(t, "delete", "app", "users")
+	if err := b.handle(context.Background(), raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 || (*sent)[0].topic != "cdc_users" || string((*sent)[0].body) != string(raw) {
+		t.Fatalf("got %q", *sent)
+	}
+
+	// an event without a valid topic is skipped
+	b, sent = newTestBridge(t, BridgeConfig{Topic: "{{.Database}}/{{.Collection}}"})
+	if err := b.handle(context.Background(), raw); err != nil || len(*sent) != 0 {
+		t.Fatalf("got %v, published %q", err, *sent)
+	}
+	if _, err := NewBridge(nil, BridgeConfig{Topic: "{{.Database"}); err == nil {
+		t.Fatal("parsed a bad template")
+	}
+}
+
+func TestBridgePublishRetry(t *testing.T) {
+	calls := 0
+	b, _ := newTestBridge(t, BridgeConfig{
+		PublishBackoff: time.Millisecond,
+		Publisher: publisherFunc(func(topic string, body []byte) error {
+			if calls++; calls < 3 {
+				return errors.New("nsqd unavailable")
+			}
+			return nil
+		}),
+	})
+	if err := b.handle(context.Background(), event(t, "update", "app", "orders")); err != nil || calls != 3 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+
+	// the event is not acknowledged when the bridge stops before the publish succeeds
+	b, _ = newTestBridge(t, BridgeConfig{
+		PublishBackoff: time.Hour,
+		Publisher: publisherFunc(func(topic string, body []byte) error {
+			return errors.New("nsqd unavailable")
+		}),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.handle(ctx, event(t, "update", "app", "orders")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
+
+// fakeCursor yields its events, then waits for the watch to end.
+type fakeCursor struct {
+	events []bson.Raw
+	cur    bson.Raw
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	if len(c.events) == 0 {
+		<-ctx.Done()
+		return false
+	}
+	c.cur, c.events = c.events[0], c.events[1:]
+	return true
+}
+
+func (c *fakeCursor) Decode(val interface{}) error {
+	return bson.Unmarshal(c.cur, val)
+}
+
+func (c *fakeCursor) ResumeToken() bson.Raw {
+	return c.cur.Lookup("_id").Document()
+}
+
+func (c *fakeCursor) Err() error {
+	return nil
+}
+
+func (c *fakeCursor) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestBridgeCheckpoint(t *testing.T) {
+	store := mongo.NewMemoryCheckpointStore()
+	var mu sync.Mutex
+	available, failed := false, make(chan struct{}, 1)
+	b, _ := newTestBridge(t, BridgeConfig{
+		Topic:             "{{.Collection}}",
+		Checkpoint:        store,
+		PublishBackoff:    time.Millisecond,
+		PublishMaxBackoff: time.Millisecond,
+		Publisher: publisherFunc(func(topic string, body []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if topic == "users" && !available {
+				select {
+				case failed <- struct{}{}:
+				default:
+				}
+				return errors.New("nsqd unavailable")
+			}
+			return nil
+		}),
+	})
+	cur := &fakeCursor{events: []bson.Raw{
+		eventID(t, "1", "insert", "app", "orders"),
+		eventID(t, "2", "insert", "app", "users"),
+		eventID(t, "3", "insert", "app", "bad topic"),
+	}}
+	b.open = func(ctx context.Context, opts *options.ChangeStreamOptions) (mongo.ChangeCursor, error) {
+		return cur, nil
+	}
+	checkpoint := func() string {
+		token, err := store.Load(context.Background(), DefaultCheckpointKey)
+		if err != nil || token == nil {
+			return ""
+		}
+		return token.Lookup("_data").StringValue()
+	}
+	b.Start(context.Background())
+	defer b.Stop(context.Background())
+
+	// the token stays at the last published event while a publish fails
+	<-failed
+	<-failed
+	if got := checkpoint(); got != "1" {
+		t.Fatalf("checkpoint at %q while publishing fails", got)
+	}
+
+	// then passes the published event and the one skipped for its topic
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for checkpoint() != "3" {
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpoint at %q", checkpoint())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBridgeStartError(t *testing.T) {
+	b, _ := newTestBridge(t, BridgeConfig{})
+	errUnauthorized := errors.New("not authorized on app")
+	b.open = func(ctx context.Context, opts *options.ChangeStreamOptions) (mongo.ChangeCursor, error) {
+		return nil, errUnauthorized
+	}
+	if err := b.Start(context.Background()); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("got %v", err)
+	}
+	if b.State() != alphaBroker.StateStopped {
+		t.Fatalf("got state %v", b.State())
+	}
+}
@@ -0,0 +1,47 @@
+package alphaBroker
+
+import "time"
+
+const (
+	DefaultRestartBackoff    = 100 * time.Millisecond
+	DefaultRestartMaxBackoff = 10 * time.Second
+	DefaultRestartWindow     = time.Minute
+	DefaultMaxRestarts       = 5
+	DefaultMailboxSize       = 1024
+	DefaultStopTimeout       = 30 * time.Second
+	DefaultPoolWorkers       = 64
+	DefaultPoolQueueSize     = 1024
+)
+
+type DrainPolicy int
+
+const (
+	// DrainFinish runs the queued operations before the component stops.
+	DrainFinish DrainPolicy = iota
+	// DrainReject completes the queued operations with ErrComponentDraining.
+	DrainReject
+)
+
+type ComponentConfig struct {
+	Supervisor SupervisorPolicy
+	Drain      DrainPolicy
+	Mailbox    MailboxConfig
+	Pool       PoolConfig
+}
+
+func (c *ComponentConfig) defaults() {
+	c.Supervisor.defaults()
+	c.Mailbox.defaults()
+	c.Pool.defaults()
+}
+
+type ApplicationConfig struct {
+	// StopTimeout bounds the shutdown started by Run on SIGINT/SIGTERM.
+	StopTimeout time.Duration
+}
+
+func (c *ApplicationConfig) defaults() {
+	if c.StopTimeout == 0 {
+		c.StopTimeout = DefaultStopTimeout
+	}
+}
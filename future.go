@@ -0,0 +1,62 @@
+package alphaBroker
+
+import (
+	"context"
+	"sync"
+)
+
+// Future is the typed result of an Operation built by NewOperation.
+type Future[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	done   chan struct{}
+	val    T
+	err    error
+}
+
+func newFuture[T any](ctx context.Context, cancel context.CancelFunc) *Future[T] {
+	return &Future[T]{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+func (f *Future[T]) complete(v T, err error) {
+	f.once.Do(func() {
+		f.val, f.err = v, err
+		close(f.done)
+		f.cancel()
+	})
+}
+
+// Done is closed once the operation has completed.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Cancel cancels the context of the operation, an operation still queued
+// will not run and Wait returns context.Canceled.
+func (f *Future[T]) Cancel() {
+	f.cancel()
+}
+
+// Wait blocks until the operation completes, its context ends or ctx ends.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case <-f.ctx.Done():
+		select {
+		case <-f.done:
+			return f.val, f.err
+		default:
+			var zero T
+			return zero, f.ctx.Err()
+		}
+	}
+}
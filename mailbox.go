@@ -0,0 +1,198 @@
+package alphaBroker
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrMailboxFull    = errors.New("mailbox full")
+	ErrMailboxDropped = errors.New("operation dropped from mailbox")
+)
+
+// Priority selects the mailbox lane of an operation, the high lane is
+// always dealt with before the normal one.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+
+	laneCount = 2
+)
+
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Resolve until the lane has room or the operation context ends.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest completes the oldest operation of the lane with ErrMailboxDropped.
+	OverflowDropOldest
+	// OverflowReject completes the new operation with ErrMailboxFull.
+	OverflowReject
+)
+
+type MailboxConfig struct {
+	// Size is the capacity of each lane.
+	Size     int
+	Overflow OverflowPolicy
+}
+
+func (c *MailboxConfig) defaults() {
+	if c.Size <= 0 {
+		c.Size = DefaultMailboxSize
+	}
+}
+
+type MailboxStats struct {
+	NormalDepth int
+	HighDepth   int
+	Rejected    uint64
+	Dropped     uint64
+}
+
+type opQueue struct {
+	items []Operation
+	head  int
+}
+
+func (q *opQueue) len() int {
+	return len(q.items) - q.head
+}
+
+func (q *opQueue) push(op Operation) {
+	q.items = append(q.items, op)
+}
+
+func (q *opQueue) pop() Operation {
+	op := q.items[q.head]
+	q.items[q.head] = Operation{}
+	q.head++
+	if q.head == len(q.items) {
+		q.items, q.head = q.items[:0], 0
+	} else if q.head > len(q.items)/2 {
+		n := copy(q.items, q.items[q.head:])
+		q.items, q.head = q.items[:n], 0
+	}
+	return op
+}
+
+type mailbox struct {
+	conf MailboxConfig
+
+	mu       sync.Mutex
+	lanes    [laneCount]opQueue
+	closed   bool
+	space    chan struct{} // closed and replaced whenever an operation is taken
+	closedCh chan struct{}
+	notEmpty chan struct{}
+
+	rejected atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+func newMailbox(conf MailboxConfig) *mailbox {
+	return &mailbox{
+		conf:     conf,
+		space:    make(chan struct{}),
+		closedCh: make(chan struct{}),
+		notEmpty: make(chan struct{}, 1),
+	}
+}
+
+func (m *mailbox) lane(p Priority) int {
+	if p >= PriorityHigh {
+		return int(PriorityHigh)
+	}
+	return int(PriorityNormal)
+}
+
+// push queues the operation or returns the error it should be completed with.
+func (m *mailbox) push(op Operation) error {
+	lane := m.lane(op.Priority)
+	m.mu.Lock()
+	for {
+		if m.closed {
+			m.mu.Unlock()
+			return ErrComponentStopped
+		}
+		if m.lanes[lane].len() < m.conf.Size {
+			break
+		}
+		switch m.conf.Overflow {
+		case OverflowReject:
+			m.mu.Unlock()
+			m.rejected.Add(1)
+			return ErrMailboxFull
+		case OverflowDropOldest:
+			dropped := m.lanes[lane].pop()
+			m.dropped.Add(1)
+			m.mu.Unlock()
+			dropped.fail(ErrMailboxDropped)
+			m.mu.Lock()
+			continue
+		}
+		space := m.space
+		m.mu.Unlock()
+		select {
+		case <-space:
+		case <-m.closedCh:
+		case <-op.context().Done():
+			m.rejected.Add(1)
+			return op.context().Err()
+		}
+		m.mu.Lock()
+	}
+	m.lanes[lane].push(op)
+	m.mu.Unlock()
+
+	select {
+	case m.notEmpty <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (m *mailbox) pop() (Operation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for lane := laneCount - 1; lane >= 0; lane-- {
+		if m.lanes[lane].len() > 0 {
+			op := m.lanes[lane].pop()
+			close(m.space)
+			m.space = make(chan struct{})
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// close rejects further pushes and returns the operations left behind.
+func (m *mailbox) close() []Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.closedCh)
+	var left []Operation
+	for lane := laneCount - 1; lane >= 0; lane-- {
+		for m.lanes[lane].len() > 0 {
+			left = append(left, m.lanes[lane].pop())
+		}
+	}
+	return left
+}
+
+func (m *mailbox) stats() MailboxStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MailboxStats{
+		NormalDepth: m.lanes[PriorityNormal].len(),
+		HighDepth:   m.lanes[PriorityHigh].len(),
+		Rejected:    m.rejected.Load(),
+		Dropped:     m.dropped.Load(),
+	}
+}
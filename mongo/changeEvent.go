@@ -0,0 +1,59 @@
+package mongo
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OperationType string
+
+const (
+	OperationInsert       OperationType = "insert"
+	OperationUpdate       OperationType = "update"
+	OperationReplace      OperationType = "replace"
+	OperationDelete       OperationType = "delete"
+	OperationDrop         OperationType = "drop"
+	OperationRename       OperationType = "rename"
+	OperationDropDatabase OperationType = "dropDatabase"
+	OperationInvalidate   OperationType = "invalidate"
+)
+
+type Namespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll,omitempty"`
+}
+
+func (ns Namespace) String() string {
+	if ns.Coll == "" {
+		return ns.DB
+	}
+	return ns.DB + "." + ns.Coll
+}
+
+// UpdateDescription describes the fields an update changed.
+type UpdateDescription struct {
+	UpdatedFields   bson.M   `bson:"updatedFields"`
+	RemovedFields   []string `bson:"removedFields"`
+	TruncatedArrays []bson.M `bson:"truncatedArrays"`
+}
+
+// ChangeEvent is a change stream event with its documents decoded as T.
+// FullDocument is set for inserts and replaces, and for updates with the
+// UpdateLookup full document. FullDocumentBeforeChange is the pre-image, set
+// when asked by SetFullDocumentBeforeChange.
+type ChangeEvent[T any] struct {
+	ID            bson.Raw            `bson:"_id"`
+	OperationType OperationType       `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	WallTime      time.Time           `bson:"wallTime"`
+	Namespace     Namespace           `bson:"ns"`
+	// To is the new namespace of a rename.
+	To          *Namespace `bson:"to"`
+	DocumentKey bson.M     `bson:"documentKey"`
+
+	FullDocument             *T                 `bson:"fullDocument"`
+	FullDocumentBeforeChange *T                 `bson:"fullDocumentBeforeChange"`
+	UpdateDescription        *UpdateDescription `bson:"updateDescription"`
+}
@@ -2,22 +2,54 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
+const (
+	DefaultWatchBackoff    = 500 * time.Millisecond
+	DefaultWatchMaxBackoff = 30 * time.Second
+)
+
+// the server errors after which a change stream cannot be resumed
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatal       = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+const labelResumableChangeStream = "ResumableChangeStreamError"
+
 // ChangeStream define what to watch? client, database or collection
 type ChangeStream struct {
 	collection string
 	database   string
 	pipeline   []bson.D
+
+	operationTypes []OperationType
+	namespaces     []Namespace
+	fullDocument   options.FullDocument
+	beforeChange   options.FullDocument
+
+	checkpoint    CheckpointStore
+	checkpointKey string
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	onOpen        func(err error)
 }
 
-type callback func(bson.M)
+type callback func(ctx context.Context, event bson.M) error
+
+// handler gets each change as a decode function.
+type handler func(ctx context.Context, decode func(val interface{}) error) error
 
 // SetCollection se collection
 func (cs *ChangeStream) SetCollection(collection string) {
@@ -34,47 +66,278 @@ func (cs *ChangeStream) SetPipeline(pipeline []bson.D) {
 	cs.pipeline = pipeline
 }
 
+// SetOperationTypes only watch the changes of these operation types
+func (cs *ChangeStream) SetOperationTypes(types ...OperationType) {
+	cs.operationTypes = types
+}
+
+// SetNamespaces only watch the changes of these namespaces, a Namespace
+// without collection matches the whole database
+func (cs *ChangeStream) SetNamespaces(namespaces ...Namespace) {
+	cs.namespaces = namespaces
+}
+
+// SetFullDocument set what the events of updates carry as full document,
+// options.UpdateLookup by default
+func (cs *ChangeStream) SetFullDocument(fullDocument options.FullDocument) {
+	cs.fullDocument = fullDocument
+}
+
+// SetFullDocumentBeforeChange set whether the events carry the pre-image of
+// the document, options.WhenAvailable or options.Required need the
+// changeStreamPreAndPostImages option on the collection
+func (cs *ChangeStream) SetFullDocumentBeforeChange(fullDocument options.FullDocument) {
+	cs.beforeChange = fullDocument
+}
+
+// SetCheckpoint set the store keeping the resume token under key, the
+// namespace watched by default
+func (cs *ChangeStream) SetCheckpoint(store CheckpointStore, key string) {
+	cs.checkpoint = store
+	cs.checkpointKey = key
+}
+
+// SetBackoff set the delays between reconnections, doubled from backoff up to maxBackoff
+func (cs *ChangeStream) SetBackoff(backoff, maxBackoff time.Duration) {
+	cs.backoff = backoff
+	cs.maxBackoff = maxBackoff
+}
+
+// SetOnOpen set fn called with the result of every attempt to open the stream
+func (cs *ChangeStream) SetOnOpen(fn func(err error)) {
+	cs.onOpen = fn
+}
+
 // NewChangeStream get a new ChangeStream
 func NewChangeStream() *ChangeStream {
-	return &ChangeStream{}
-}
-
-// Watch print oplog in JSON format
-func (cs *ChangeStream) Watch(client *mongo.Client, cb callback) {
-	var err error
-	var ctx = context.Background()
-	var cur *mongo.ChangeStream
-	fmt.Println("pipeline", cs.pipeline)
-	opts := options.ChangeStream()
-	opts.SetFullDocument("updateLookup")
-	if cs.collection != "" && cs.database != "" {
-		fmt.Println("Watching", cs.database+"."+cs.collection)
-		var coll = client.Database(cs.database).Collection(cs.collection)
-		if cur, err = coll.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
+	return &ChangeStream{
+		backoff:    DefaultWatchBackoff,
+		maxBackoff: DefaultWatchMaxBackoff,
+	}
+}
+
+// namespace is the watched namespace, "" when watching the whole deployment
+func (cs *ChangeStream) namespace() string {
+	switch {
+	case cs.collection != "" && cs.database != "":
+		return cs.database + "." + cs.collection
+	case cs.database != "":
+		return cs.database
+	}
+	return ""
+}
+
+// ChangeCursor is the part of *mongo.ChangeStream Watch uses
+type ChangeCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Watch calls cb with every change until ctx ends or cb fails, and returns
+// why it stopped. The stream is reopened with backoff after an error and
+// resumes after the last event cb handled, the resume token is saved in the
+// checkpoint store once cb returns so that a restarted watch resumes there:
+// an event is delivered at least once.
+func (cs *ChangeStream) Watch(ctx context.Context, client *mongo.Client, cb callback) error {
+	return cs.watch(ctx, cs.opener(client), mapHandler(cb))
+}
+
+func mapHandler(cb callback) handler {
+	return func(ctx context.Context, decode func(interface{}) error) error {
+		var event bson.M
+		if err := decode(&event); err != nil {
+			return fmt.Errorf("decode change event: %w", err)
 		}
-	} else if cs.database != "" {
-		fmt.Println("Watching", cs.database)
-		var db = client.Database(cs.database)
-		if cur, err = db.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
+		return cb(ctx, event)
+	}
+}
+
+// WatchEvents is Watch with the changes decoded as ChangeEvent[T].
+func WatchEvents[T any](ctx context.Context, cs *ChangeStream, client *mongo.Client, cb func(ctx context.Context, event *ChangeEvent[T]) error) error {
+	return cs.watch(ctx, cs.opener(client), eventHandler(cb))
+}
+
+func eventHandler[T any](cb func(ctx context.Context, event *ChangeEvent[T]) error) handler {
+	return func(ctx context.Context, decode func(interface{}) error) error {
+		event := new(ChangeEvent[T])
+		if err := decode(event); err != nil {
+			return fmt.Errorf("decode change event: %w", err)
 		}
-	} else {
-		fmt.Println("Watching all")
-		if cur, err = client.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
+		return cb(ctx, event)
+	}
+}
+
+// WatchRaw is Watch with the changes as they were received.
+func (cs *ChangeStream) WatchRaw(ctx context.Context, client *mongo.Client, cb func(ctx context.Context, event bson.Raw) error) error {
+	return cs.watch(ctx, cs.opener(client), rawHandler(cb))
+}
+
+// WatchRawOpen is WatchRaw with the streams opened by open, called with the
+// options to resume from every time the stream is opened.
+func (cs *ChangeStream) WatchRawOpen(ctx context.Context, open func(ctx context.Context, opts *options.ChangeStreamOptions) (ChangeCursor, error),
+	cb func(ctx context.Context, event bson.Raw) error) error {
+	return cs.watch(ctx, open, rawHandler(cb))
+}
+
+func rawHandler(cb func(ctx context.Context, event bson.Raw) error) handler {
+	return func(ctx context.Context, decode func(interface{}) error) error {
+		var event bson.Raw
+		if err := decode(&event); err != nil {
+			return fmt.Errorf("decode change event: %w", err)
 		}
+		return cb(ctx, event)
 	}
+}
 
-	defer cur.Close(ctx)
-	var doc bson.M
+func (cs *ChangeStream) opener(client *mongo.Client) func(context.Context, *options.ChangeStreamOptions) (ChangeCursor, error) {
+	pipeline := cs.buildPipeline()
+	return func(ctx context.Context, opts *options.ChangeStreamOptions) (ChangeCursor, error) {
+		switch {
+		case cs.collection != "" && cs.database != "":
+			return client.Database(cs.database).Collection(cs.collection).Watch(ctx, pipeline, opts)
+		case cs.database != "":
+			return client.Database(cs.database).Watch(ctx, pipeline, opts)
+		}
+		return client.Watch(ctx, pipeline, opts)
+	}
+}
+
+// buildPipeline appends the operation type and namespace filters to the pipeline.
+func (cs *ChangeStream) buildPipeline() []bson.D {
+	pipeline := append([]bson.D{}, cs.pipeline...)
+	if len(cs.operationTypes) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": cs.operationTypes}}}})
+	}
+	if len(cs.namespaces) > 0 {
+		or := make(bson.A, 0, len(cs.namespaces))
+		for _, ns := range cs.namespaces {
+			match := bson.D{{Key: "ns.db", Value: ns.DB}}
+			if ns.Coll != "" {
+				match = append(match, bson.E{Key: "ns.coll", Value: ns.Coll})
+			}
+			or = append(or, match)
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": or}}})
+	}
+	return pipeline
+}
+
+func (cs *ChangeStream) options() *options.ChangeStreamOptions {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if cs.fullDocument != "" {
+		opts.SetFullDocument(cs.fullDocument)
+	}
+	if cs.beforeChange != "" {
+		opts.SetFullDocumentBeforeChange(cs.beforeChange)
+	}
+	return opts
+}
+
+func (cs *ChangeStream) watch(ctx context.Context, open func(context.Context, *options.ChangeStreamOptions) (ChangeCursor, error), cb handler) error {
+	key := cs.checkpointKey
+	if key == "" {
+		key = cs.namespace()
+	}
+	var token bson.Raw
+	if cs.checkpoint != nil {
+		var err error
+		if token, err = cs.checkpoint.Load(ctx, key); err != nil {
+			return fmt.Errorf("change stream %q: load checkpoint: %w", key, err)
+		}
+	}
+	minBackoff, maxBackoff := cs.backoff, cs.maxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultWatchBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = DefaultWatchMaxBackoff
+	}
+	failures := 0
+	for {
+		opts := cs.options()
+		if token != nil {
+			opts.SetStartAfter(token)
+		}
+		handled, err := cs.stream(ctx, key, open, opts, cb, &token)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var cbErr *callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		if !resumable(err) {
+			return fmt.Errorf("change stream %q: %w", key, err)
+		}
+		if handled {
+			failures = 0
+		}
+		failures++
+		backoff := alphaBroker.Backoff(minBackoff, maxBackoff, failures)
+		log.Printf("change stream %q: %v, reconnecting in %v", key, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+type callbackError struct {
+	err error
+}
+
+func (e *callbackError) Error() string {
+	return e.err.Error()
+}
+
+// stream delivers the events of one open stream, it reports whether an
+// event was handled and why the stream ended.
+func (cs *ChangeStream) stream(ctx context.Context, key string, open func(context.Context, *options.ChangeStreamOptions) (ChangeCursor, error),
+	opts *options.ChangeStreamOptions, cb handler, token *bson.Raw) (bool, error) {
+	cur, err := open(ctx, opts)
+	if cs.onOpen != nil {
+		cs.onOpen(err)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer cur.Close(context.WithoutCancel(ctx))
+	handled := false
 	for cur.Next(ctx) {
-		if err = cur.Decode(&doc); err != nil {
-			log.Fatal(err)
+		if err := cb(ctx, cur.Decode); err != nil {
+			return handled, &callbackError{err}
 		}
-		cb(doc)
+		handled = true
+		*token = cur.ResumeToken()
+		if cs.checkpoint != nil {
+			if err := cs.checkpoint.Save(ctx, key, *token); err != nil {
+				return handled, fmt.Errorf("save checkpoint: %w", err)
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return handled, err
 	}
-	if err = cur.Err(); err != nil {
-		log.Fatal(err)
+	return handled, errors.New("change stream closed")
+}
+
+// resumable reports whether the stream is reopened after err: network
+// errors, failures to reach a server and the errors labelled resumable by
+// the server. Anything else, like an authorization failure, an invalid
+// pipeline or a stream closed by an invalidate event, ends the watch.
+func resumable(err error) bool {
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		for _, code := range []int{codeInvalidResumeToken, codeChangeStreamFatal, codeChangeStreamHistoryLost} {
+			if se.HasErrorCode(code) {
+				return false
+			}
+		}
 	}
+	var sse topology.ServerSelectionError
+	return hasErrorLabel(err, labelResumableChangeStream) || mongo.IsNetworkError(err) || errors.As(err, &sse)
 }
@@ -0,0 +1,242 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeCursor yields its events, then ends with err.
+type fakeCursor struct {
+	events []string
+	err    error
+	cur    string
+	// docs are the events by id, an insert without document by default
+	docs map[string]bson.M
+}
+
+func token(id string) bson.Raw {
+	raw, _ := bson.Marshal(bson.M{"_data": id})
+	return raw
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	if len(c.events) == 0 {
+		if c.err == nil {
+			<-ctx.Done()
+			c.err = ctx.Err()
+		}
+		return false
+	}
+	c.cur, c.events = c.events[0], c.events[1:]
+	return true
+}
+
+func (c *fakeCursor) Decode(val interface{}) error {
+	doc, ok := c.docs[c.cur]
+	if !ok {
+		doc = bson.M{"operationType": "insert"}
+	}
+	doc["_id"] = bson.M{"_data": c.cur}
+	raw, _ := bson.Marshal(doc)
+	return bson.Unmarshal(raw, val)
+}
+
+func (c *fakeCursor) ResumeToken() bson.Raw {
+	return token(c.cur)
+}
+
+func (c *fakeCursor) Err() error {
+	return c.err
+}
+
+func (c *fakeCursor) Close(ctx context.Context) error {
+	return nil
+}
+
+var errRefused = mongo.CommandError{Message: "connection refused", Labels: []string{"NetworkError"}}
+
+// fakeServer opens the cursors in turn and records where they start.
+type fakeServer struct {
+	cursors []*fakeCursor
+	opened  []string
+}
+
+func (s *fakeServer) open(ctx context.Context, opts *options.ChangeStreamOptions) (ChangeCursor, error) {
+	start := ""
+	if opts.StartAfter != nil {
+		start = opts.StartAfter.(bson.Raw).Lookup("_data").StringValue()
+	}
+	s.opened = append(s.opened, start)
+	c := s.cursors[0]
+	s.cursors = s.cursors[1:]
+	if c == nil {
+		return nil, errRefused
+	}
+	return c, nil
+}
+
+func TestChangeStreamResume(t *testing.T) {
+	store, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewChangeStream()
+	cs.SetDatabase("app")
+	cs.SetCollection("orders")
+	cs.SetCheckpoint(store, "")
+	cs.SetBackoff(time.Millisecond, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &fakeServer{cursors: []*fakeCursor{
+		nil,
+		{events: []string{"1", "2"}, err: mongo.CommandError{Message: "cursor killed", Labels: []string{labelResumableChangeStream}}},
+		{events: []string{"3"}},
+	}}
+	var got []string
+	err = cs.watch(ctx, server.open, mapHandler(func(ctx context.Context, event bson.M) error {
+		got = append(got, event["_id"].(bson.M)["_data"].(string))
+		if len(got) == 3 {
+			cancel()
+		}
+		return nil
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+	if len(got) != 3 || got[2] != "3" {
+		t.Fatalf("got %v", got)
+	}
+	if want := []string{"", "", "2"}; len(server.opened) != 3 || server.opened[2] != want[2] {
+		t.Fatalf("opened at %v, want %v", server.opened, want)
+	}
+
+	// a restarted watch resumes after the last handled event
+	restarted, _ := NewFileCheckpointStore(store.path)
+	cs.SetCheckpoint(restarted, "")
+	server = &fakeServer{cursors: []*fakeCursor{{err: mongo.CommandError{Code: codeChangeStreamHistoryLost}}}}
+	err = cs.watch(context.Background(), server.open, mapHandler(func(ctx context.Context, event bson.M) error { return nil }))
+	if server.opened[0] != "3" {
+		t.Fatalf("resumed at %v", server.opened)
+	}
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) || ce.Code != codeChangeStreamHistoryLost {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestChangeStreamFatalError(t *testing.T) {
+	for _, fatal := range []error{
+		&mongo.CommandError{Code: 13, Name: "Unauthorized"},
+		&mongo.CommandError{Code: 40324, Name: "Location40324", Message: "Unrecognized pipeline stage name"},
+		errors.New("change stream closed"),
+	} {
+		cs := NewChangeStream()
+		cs.SetBackoff(time.Millisecond, time.Millisecond)
+		server := &fakeServer{cursors: []*fakeCursor{nil, {err: fatal}, {}}}
+		err := cs.watch(context.Background(), server.open, mapHandler(func(ctx context.Context, event bson.M) error { return nil }))
+		if !errors.Is(err, fatal) || len(server.opened) != 2 {
+			t.Fatalf("got %v after opening %d streams", err, len(server.opened))
+		}
+	}
+}
+
+func TestChangeStreamCallbackError(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	cs := NewChangeStream()
+	cs.SetCheckpoint(store, "all")
+	errFailed := errors.New("failed")
+	server := &fakeServer{cursors: []*fakeCursor{{events: []string{"1", "2"}}}}
+	err := cs.watch(context.Background(), server.open, mapHandler(func(ctx context.Context, event bson.M) error {
+		if event["_id"].(bson.M)["_data"] == "2" {
+			return errFailed
+		}
+		return nil
+	}))
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("got %v", err)
+	}
+	if tok, _ := store.Load(context.Background(), "all"); tok.Lookup("_data").StringValue() != "1" {
+		t.Fatalf("checkpoint at %v", tok)
+	}
+}
+
+func TestChangeStreamPipeline(t *testing.T) {
+	cs := NewChangeStream()
+	cs.SetPipeline([]bson.D{{{Key: "$project", Value: bson.M{"fullDocument.secret": 0}}}})
+	cs.SetOperationTypes(OperationInsert, OperationUpdate)
+	cs.SetNamespaces(Namespace{DB: "app", Coll: "orders"}, Namespace{DB: "audit"})
+	got, _ := bson.MarshalExtJSON(bson.M{"pipeline": cs.buildPipeline()}, false, false)
+	want, _ := bson.MarshalExtJSON(bson.M{"pipeline": bson.A{
+		bson.M{"$project": bson.M{"fullDocument.secret": 0}},
+		bson.M{"$match": bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update"}}}},
+		bson.M{"$match": bson.M{"$or": bson.A{bson.D{{Key: "ns.db", Value: "app"}, {Key: "ns.coll", Value: "orders"}}, bson.M{"ns.db": "audit"}}}},
+	}}, false, false)
+	if string(got) != string(want) {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+
+	cs.SetFullDocumentBeforeChange(options.WhenAvailable)
+	opts := cs.options()
+	if *opts.FullDocument != options.UpdateLookup || *opts.FullDocumentBeforeChange != options.WhenAvailable {
+		t.Fatalf("got %v %v", *opts.FullDocument, *opts.FullDocumentBeforeChange)
+	}
+}
+
+type order struct {
+	ID     int    `bson:"_id"`
+	Status string `bson:"status"`
+}
+
+func TestChangeEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &fakeServer{cursors: []*fakeCursor{{
+		events: []string{"1"},
+		docs: map[string]bson.M{"1": {
+			"operationType":            "update",
+			"clusterTime":              primitive.Timestamp{T: 1700000000, I: 3},
+			"ns":                       bson.M{"db": "app", "coll": "orders"},
+			"documentKey":              bson.M{"_id": 7},
+			"fullDocument":             bson.M{"_id": 7, "status": "paid"},
+			"fullDocumentBeforeChange": bson.M{"_id": 7, "status": "new"},
+			"updateDescription": bson.M{
+				"updatedFields": bson.M{"status": "paid"},
+				"removedFields": bson.A{"note"},
+			},
+		}},
+	}}}
+	var event *ChangeEvent[order]
+	err := NewChangeStream().watch(ctx, server.open, eventHandler(func(ctx context.Context, e *ChangeEvent[order]) error {
+		event = e
+		cancel()
+		return nil
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if event.OperationType != OperationUpdate || event.Namespace.String() != "app.orders" ||
+		event.ClusterTime.T != 1700000000 || event.DocumentKey["_id"] != int32(7) ||
+		event.FullDocument.Status != "paid" || event.FullDocumentBeforeChange.Status != "new" ||
+		event.UpdateDescription.UpdatedFields["status"] != "paid" || event.UpdateDescription.RemovedFields[0] != "note" {
+		t.Fatalf("got %+v", event)
+	}
+
+	// a document that does not decode as T stops the watch
+	server = &fakeServer{cursors: []*fakeCursor{{
+		events: []string{"2"},
+		docs:   map[string]bson.M{"2": {"operationType": "insert", "fullDocument": bson.M{"_id": "not a number"}}},
+	}}}
+	err = NewChangeStream().watch(context.Background(), server.open, eventHandler(func(ctx context.Context, e *ChangeEvent[order]) error {
+		return nil
+	}))
+	if err == nil || len(server.opened) != 1 {
+		t.Fatalf("got %v after %d opens", err, len(server.opened))
+	}
+}
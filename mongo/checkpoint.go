@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckpointStore keeps the resume tokens of the change streams by key.
+type CheckpointStore interface {
+	// Load returns the token saved under key, nil when there is none.
+	Load(ctx context.Context, key string) (bson.Raw, error)
+	Save(ctx context.Context, key string, token bson.Raw) error
+}
+
+type MemoryCheckpointStore struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{tokens: make(map[string]bson.Raw)}
+}
+
+func (s *MemoryCheckpointStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[key], nil
+}
+
+func (s *MemoryCheckpointStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = append(bson.Raw(nil), token...)
+	return nil
+}
+
+// FileCheckpointStore keeps the tokens in a JSON file, rewritten through a
+// temporary file renamed over it.
+type FileCheckpointStore struct {
+	path string
+
+	mu     sync.Mutex
+	tokens map[string][]byte
+}
+
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := &FileCheckpointStore{path: path, tokens: make(map[string][]byte)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileCheckpointStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[key], nil
+}
+
+func (s *FileCheckpointStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = append([]byte(nil), token...)
+	data, err := json.Marshal(s.tokens)
+	if err != nil {
+		return err
+	}
+	return alphaBroker.WriteFileAtomic(s.path, data)
+}
+
+// MongoCheckpointStore keeps the tokens in a collection, one document per
+// key with the key as _id.
+type MongoCheckpointStore struct {
+	Client   *Client
+	DBName   string
+	CollName string
+}
+
+func NewMongoCheckpointStore(client *Client, dbName, collName string) *MongoCheckpointStore {
+	return &MongoCheckpointStore{Client: client, DBName: dbName, CollName: collName}
+}
+
+type checkpoint struct {
+	Key       string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (s *MongoCheckpointStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	var c checkpoint
+	err := s.Client.FindOne(ctx, s.DBName, s.CollName, bson.M{"_id": key}).Decode(&c)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return c.Token, err
+}
+
+func (s *MongoCheckpointStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	_, err := s.Client.ReplaceOneWithOption(ctx, s.DBName, s.CollName, bson.M{"_id": key},
+		checkpoint{Key: key, Token: token, UpdatedAt: time.Now()}, options.Replace().SetUpsert(true))
+	return err
+}
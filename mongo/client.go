@@ -12,18 +12,25 @@ import (
 type Client struct {
 	*alphaBroker.BaseComponent
 	RealCli *mongo.Client
+
+	interceptors []Interceptor
+	retry        *RetryPolicy
+	breaker      *breaker
+	stats        clientStats
 }
 
-func NewClient(ctx context.Context, config *Config) *mongo.Client {
+// NewClient 连接 MongoDB 并确认主节点可用，失败时返回 *Error。
+func NewClient(ctx context.Context, config *Config) (*mongo.Client, error) {
 	opt := options.Client().ApplyURI(config.URI).SetAuth(config.Credential)
 	opt.SetMinPoolSize(config.MinPoolSize).SetMaxPoolSize(config.MaxPoolSize)
 	client, err := mongo.Connect(ctx, opt)
 	if err != nil {
-		panic(err)
+		return nil, wrapError("connect", "", "", err)
 	}
 	err = client.Ping(ctx, readpref.Primary())
 	if err != nil {
-		panic(err)
+		_ = client.Disconnect(context.WithoutCancel(ctx))
+		return nil, wrapError("ping", "", "", err)
 	}
-	return client
+	return client, nil
 }
@@ -8,6 +8,7 @@ import (
 
 	alphaBroker "github.com/AlphaMinZ/alpha_broker"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -20,7 +21,16 @@ func (t testOwner) Launch() {
 }
 
 func (t testOwner) Stop() {
-	t.c.Stop()
+	t.c.Stop(context.Background())
+}
+
+func mustNewClient(t *testing.T, ctx context.Context, config *Config) *mongo.Client {
+	t.Helper()
+	client, err := NewClient(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
 }
 
 func TestClient(t *testing.T) {
@@ -28,7 +38,7 @@ func TestClient(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -0,0 +1,112 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+)
+
+// 错误分类，用 errors.Is 判断 Client 方法返回的错误属于哪一类。
+var (
+	ErrNotFound      = errors.New("mongo: not found")
+	ErrDuplicateKey  = errors.New("mongo: duplicate key")
+	ErrTimeout       = errors.New("mongo: timeout")
+	ErrNetwork       = errors.New("mongo: network error")
+	ErrWriteConflict = errors.New("mongo: write conflict")
+	ErrUnauthorized  = errors.New("mongo: unauthorized")
+)
+
+// 服务端错误码
+const (
+	codeUnauthorized         = 13
+	codeAuthenticationFailed = 18
+	codeWriteConflict        = 112
+)
+
+// Error 是 Client 方法返回的错误，记录了出错的操作、数据库和集合。
+// errors.Is 既可以匹配错误分类 Kind，也可以匹配驱动返回的原始错误 Err，
+// 无法分类的错误 Kind 为 nil。
+type Error struct {
+	Op         string
+	Database   string
+	Collection string
+	Kind       error
+	Err        error
+}
+
+func (e *Error) Error() string {
+	ns := e.Database
+	if e.Collection != "" {
+		ns += "." + e.Collection
+	}
+	if ns == "" {
+		return fmt.Sprintf("mongo %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("mongo %s %s: %v", e.Op, ns, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// wrapError 给驱动返回的错误加上操作上下文和分类，已经包装过的错误原样返回。
+func wrapError(op, dbName, collName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, Database: dbName, Collection: collName, Kind: classify(err), Err: err}
+}
+
+// classify 返回驱动错误的分类，无法分类时返回 nil。
+func classify(err error) error {
+	var se mongo.ServerError
+	isServerError := errors.As(err, &se)
+	var ae *auth.Error
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicateKey
+	case isServerError && se.HasErrorCode(codeWriteConflict):
+		return ErrWriteConflict
+	case isServerError && (se.HasErrorCode(codeUnauthorized) || se.HasErrorCode(codeAuthenticationFailed)),
+		errors.As(err, &ae):
+		return ErrUnauthorized
+	case mongo.IsTimeout(err):
+		return ErrTimeout
+	case mongo.IsNetworkError(err):
+		return ErrNetwork
+	}
+	return nil
+}
+
+// SingleResult 是 FindOne 等方法返回的 mongo.SingleResult，
+// Decode、Err 和 Raw 返回的错误与其他方法一样是 *Error，
+// 没有找到文档时错误分类为 ErrNotFound。
+type SingleResult struct {
+	*mongo.SingleResult
+	op, dbName, collName string
+}
+
+func (r *SingleResult) Decode(v interface{}) error {
+	return wrapError(r.op, r.dbName, r.collName, r.SingleResult.Decode(v))
+}
+
+func (r *SingleResult) Err() error {
+	return wrapError(r.op, r.dbName, r.collName, r.SingleResult.Err())
+}
+
+func (r *SingleResult) Raw() (bson.Raw, error) {
+	raw, err := r.SingleResult.Raw()
+	return raw, wrapError(r.op, r.dbName, r.collName, err)
+}
@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassify(t *testing.T) {
+	errOther := errors.New("other")
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no documents", mongo.ErrNoDocuments, ErrNotFound},
+		{"duplicate key", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, ErrDuplicateKey},
+		{"write conflict", mongo.CommandError{Code: 112, Labels: []string{labelTransientTransaction}}, ErrWriteConflict},
+		{"unauthorized", mongo.CommandError{Code: 13}, ErrUnauthorized},
+		{"authentication failed", mongo.CommandError{Code: 18}, ErrUnauthorized},
+		{"deadline", context.DeadlineExceeded, ErrTimeout},
+		{"max time", mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}, ErrTimeout},
+		{"network", mongo.CommandError{Labels: []string{"NetworkError"}}, ErrNetwork},
+		{"other", errOther, nil},
+	}
+	for _, c := range cases {
+		err := wrapError("updateOne", "app", "orders", c.err)
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != c.want {
+			t.Fatalf("%s: got %v", c.name, e.Kind)
+		}
+		if c.want != nil && !errors.Is(err, c.want) {
+			t.Fatalf("%s: %v is not %v", c.name, err, c.want)
+		}
+		if !reflect.DeepEqual(e.Err, c.err) {
+			t.Fatalf("%s: %v does not wrap the driver error", c.name, err)
+		}
+		if wrapError("find", "", "", err) != err {
+			t.Fatalf("%s: wrapped twice", c.name)
+		}
+	}
+	if wrapError("find", "app", "orders", nil) != nil {
+		t.Fatal("nil wrapped")
+	}
+	err := wrapError("insertOne", "app", "orders", errOther)
+	if err.Error() != "mongo insertOne app.orders: other" {
+		t.Fatal(err)
+	}
+}
+
+func TestSingleResultError(t *testing.T) {
+	r := &SingleResult{mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil), "findOne", "app", "orders"}
+	var doc bson.M
+	err := r.Decode(&doc)
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatal(err)
+	}
+	if err := r.Err(); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+}
+
+func TestNewClientError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	client, err := NewClient(ctx, &Config{URI: "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100&connectTimeoutMS=100"})
+	var e *Error
+	if client != nil || !errors.As(err, &e) || e.Op != "ping" {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("%v is not a timeout", err)
+	}
+}
@@ -0,0 +1,163 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OpInfo 描述一次 Client 操作。拦截器在调用 next 之前可以替换 Filter、Update、
+// Pipeline 和 Documents，例如在 Filter 中加入租户条件；
+// next 返回之后 Duration、Attempts 和 Err 记录了执行的结果。
+type OpInfo struct {
+	Name       string
+	Database   string
+	Collection string
+
+	Filter interface{}
+	// Update 是更新的内容或者替换的文档。
+	Update   interface{}
+	Pipeline interface{}
+	// Documents 是插入的文档。
+	Documents []interface{}
+	Command   interface{}
+	// FindOptions 是 FindWithOption 的查询选项。
+	FindOptions *options.FindOptions
+
+	// Duration 是包括重试在内的执行时间。
+	Duration time.Duration
+	Attempts int
+	Err      error
+}
+
+// Namespace 返回操作的 db.collection。
+func (op *OpInfo) Namespace() string {
+	if op.Collection == "" {
+		return op.Database
+	}
+	return op.Database + "." + op.Collection
+}
+
+// String 返回操作的描述，不包括插入的文档。
+func (op *OpInfo) String() string {
+	s := op.Name + " " + op.Namespace()
+	if len(op.Documents) > 0 {
+		s += fmt.Sprintf(" %d documents", len(op.Documents))
+	}
+	if doc := op.fields(); len(doc) > 0 {
+		if b, err := bson.MarshalExtJSON(doc, false, false); err == nil {
+			s += " " + string(b)
+		} else {
+			s += fmt.Sprintf(" %v", doc)
+		}
+	}
+	return s
+}
+
+// fields 返回操作中不为 nil 的 filter、update、pipeline 和 command。
+func (op *OpInfo) fields() bson.D {
+	var doc bson.D
+	for _, e := range []bson.E{{Key: "filter", Value: op.Filter}, {Key: "update", Value: op.Update},
+		{Key: "pipeline", Value: op.Pipeline}, {Key: "command", Value: op.Command}} {
+		if e.Value != nil {
+			doc = append(doc, e)
+		}
+	}
+	return doc
+}
+
+// Interceptor 包裹 Client 的每一次操作，调用 next 执行操作（以及后面的拦截器），
+// 可以不调用 next 直接返回错误来拒绝操作。
+type Interceptor func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error
+
+// Use 注册拦截器，先注册的在外层，需要在使用 Client 之前注册。
+// 拦截器包裹的是包括重试在内的整个操作。
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// intercept 依次经过拦截器执行 fn。
+func (c *Client) intercept(ctx context.Context, op *OpInfo, fn func(ctx context.Context) error) error {
+	next := fn
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.interceptors[i], next
+		next = func(ctx context.Context) error {
+			return interceptor(ctx, op, inner)
+		}
+	}
+	return next(ctx)
+}
+
+// SlowQueryLogger 返回记录慢操作的拦截器，执行时间不少于 threshold 的操作用 log.Printf 记录。
+// 记录的是操作的形状 Shape，查询和更新中的值不会出现在日志中。
+func SlowQueryLogger(threshold time.Duration) Interceptor {
+	return func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		if op.Duration >= threshold {
+			if err != nil {
+				log.Printf("mongo slow %s took %v after %d attempts: %v", op.Shape(), op.Duration, op.Attempts, err)
+			} else {
+				log.Printf("mongo slow %s took %v after %d attempts", op.Shape(), op.Duration, op.Attempts)
+			}
+		}
+		return err
+	}
+}
+
+// OpTiming 是一类操作的次数、失败次数和耗时。
+type OpTiming struct {
+	Count  uint64
+	Errors uint64
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// OpTimer 按操作名和 db.collection 统计操作的耗时，Intercept 是它的拦截器：
+//
+//	timer := NewOpTimer()
+//	client.Use(timer.Intercept)
+type OpTimer struct {
+	mu      sync.Mutex
+	timings map[string]*OpTiming
+}
+
+func NewOpTimer() *OpTimer {
+	return &OpTimer{timings: make(map[string]*OpTiming)}
+}
+
+func (t *OpTimer) Intercept(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+	err := next(ctx)
+	key := op.Name + " " + op.Namespace()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timing, ok := t.timings[key]
+	if !ok {
+		timing = &OpTiming{}
+		t.timings[key] = timing
+	}
+	timing.Count++
+	if err != nil {
+		timing.Errors++
+	}
+	timing.Total += op.Duration
+	if op.Duration > timing.Max {
+		timing.Max = op.Duration
+	}
+	return err
+}
+
+// Timings 返回各类操作的统计，键为 "操作名 db.collection"，例如 "find app.orders"。
+func (t *OpTimer) Timings() map[string]OpTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := make(map[string]OpTiming, len(t.timings))
+	for key, timing := range t.timings {
+		timings[key] = *timing
+	}
+	return timings
+}
@@ -0,0 +1,130 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	c := &Client{}
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	var order []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+			order = append(order, name)
+			err := next(ctx)
+			order = append(order, name+" done")
+			return err
+		}
+	}
+	tenant := func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+		op.Filter = bson.D{{Key: "$and", Value: bson.A{op.Filter, bson.D{{Key: "tenant", Value: "t1"}}}}}
+		return next(ctx)
+	}
+	var seen *OpInfo
+	c.Use(record("outer"), record("inner"), tenant, func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		seen = &OpInfo{Attempts: op.Attempts, Err: op.Err, Duration: op.Duration}
+		return err
+	})
+
+	op := &OpInfo{Name: "find", Database: "app", Collection: "orders", Filter: bson.D{{Key: "status", Value: "paid"}}}
+	calls := 0
+	var filter interface{}
+	err := c.do(context.Background(), op, func(ctx context.Context) error {
+		filter = op.Filter
+		calls++
+		if calls == 1 {
+			time.Sleep(time.Millisecond)
+			return errNetwork
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	if want := []string{"outer", "inner", "inner done", "outer done"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got order %v", order)
+	}
+	want := bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "status", Value: "paid"}}, bson.D{{Key: "tenant", Value: "t1"}}}}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Fatalf("got filter %v", filter)
+	}
+	if seen.Attempts != 2 || seen.Err != nil || seen.Duration < time.Millisecond {
+		t.Fatalf("got %+v", seen)
+	}
+}
+
+func TestInterceptorReject(t *testing.T) {
+	c := &Client{}
+	errReadOnly := errors.New("read only")
+	c.Use(func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+		if op.Name != "find" && op.Name != "findOne" {
+			return errReadOnly
+		}
+		return next(ctx)
+	})
+	ctx := context.Background()
+
+	calls := 0
+	err := c.do(ctx, ordersOp("deleteMany"), failing(&calls))
+	var e *Error
+	if !errors.As(err, &e) || e.Op != "deleteMany" || !errors.Is(err, errReadOnly) || calls != 0 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	var doc bson.M
+	if err := c.singleResult(ctx, ordersOp("findOneAndDelete"), nil).Decode(&doc); !errors.Is(err, errReadOnly) {
+		t.Fatal(err)
+	}
+}
+
+func TestInterceptorTiming(t *testing.T) {
+	c := &Client{}
+	timer := NewOpTimer()
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+	c.Use(timer.Intercept, SlowQueryLogger(5*time.Millisecond))
+	ctx := context.Background()
+
+	calls := 0
+	c.do(ctx, ordersOp("find"), failing(&calls))
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	op := &OpInfo{Name: "updateOne", Database: "app", Collection: "orders",
+		Filter: bson.D{{Key: "_id", Value: 1}}, Update: bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "paid"}}}}}
+	c.do(ctx, op, func(ctx context.Context) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	timings := timer.Timings()
+	if got := timings["find app.orders"]; got.Count != 2 || got.Errors != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if got := timings["updateOne app.orders"]; got.Count != 1 || got.Max < 5*time.Millisecond || got.Total != got.Max {
+		t.Fatalf("got %+v", got)
+	}
+	want := `mongo slow updateOne app.orders {"filter":{"_id":"?"},"update":{"$set":{"status":"?"}}} took`
+	if !strings.Contains(buf.String(), want) || strings.Contains(buf.String(), "paid") || strings.Contains(buf.String(), "find") {
+		t.Fatalf("got log %q", buf.String())
+	}
+}
+
+func TestOpInfoString(t *testing.T) {
+	op := &OpInfo{Name: "insertMany", Database: "app", Collection: "orders", Documents: []interface{}{bson.M{}, bson.M{}}}
+	if got := op.String(); got != "insertMany app.orders 2 documents" {
+		t.Fatal(got)
+	}
+	op = &OpInfo{Name: "runCommand", Database: "admin", Command: bson.D{{Key: "ping", Value: 1}}}
+	if got := op.String(); got != `runCommand admin {"command":{"ping":1}}` {
+		t.Fatal(got)
+	}
+}
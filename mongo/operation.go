@@ -18,34 +18,46 @@ import (
  */
 func (c *Client) Aggregate(ctx context.Context, dbName, collName string, pipeline mongo.Pipeline) (*mongo.Cursor, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	cursor, err := collection.Aggregate(ctx, pipeline)
-	return cursor, err
+	op := &OpInfo{Name: "aggregate", Database: dbName, Collection: collName, Pipeline: pipeline}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.Cursor, error) {
+		return collection.Aggregate(ctx, op.Pipeline)
+	})
 }
 
 func (c *Client) InsertOne(ctx context.Context, dbName, collName string, data interface{}) (*mongo.InsertOneResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	res, err := collection.InsertOne(ctx, data)
-	return res, err
+	op := &OpInfo{Name: "insertOne", Database: dbName, Collection: collName, Documents: []interface{}{data}}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.InsertOneResult, error) {
+		return collection.InsertOne(ctx, op.Documents[0])
+	})
 }
 
 func (c *Client) InsertMany(ctx context.Context, dbName, collName string, data []interface{}) (*mongo.InsertManyResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	res, err := collection.InsertMany(ctx, data)
-	return res, err
+	op := &OpInfo{Name: "insertMany", Database: dbName, Collection: collName, Documents: data}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.InsertManyResult, error) {
+		return collection.InsertMany(ctx, op.Documents)
+	})
 }
 
-func (c *Client) FindOne(ctx context.Context, dbName, collName string, filter interface{}) *mongo.SingleResult {
+func (c *Client) FindOne(ctx context.Context, dbName, collName string, filter interface{}) *SingleResult {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	return collection.FindOne(ctx, filter)
+	op := &OpInfo{Name: "findOne", Database: dbName, Collection: collName, Filter: filter}
+	return c.singleResult(ctx, op, func(ctx context.Context) *mongo.SingleResult {
+		return collection.FindOne(ctx, op.Filter)
+	})
 }
 
 func (c *Client) Find(ctx context.Context, dbName, collName string, filter interface{}) (*mongo.Cursor, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	return collection.Find(ctx, filter)
+	op := &OpInfo{Name: "find", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.Cursor, error) {
+		return collection.Find(ctx, op.Filter)
+	})
 }
 
 /*
@@ -55,156 +67,136 @@ func (c *Client) Find(ctx context.Context, dbName, collName string, filter inter
 func (c *Client) FindWithOption(ctx context.Context, dbName, collName string, filter interface{},
 	findOptions *options.FindOptions) (*mongo.Cursor, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	return collection.Find(ctx, filter, findOptions)
+	op := &OpInfo{Name: "find", Database: dbName, Collection: collName, Filter: filter, FindOptions: findOptions}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.Cursor, error) {
+		return collection.Find(ctx, op.Filter, findOptions)
+	})
 }
 
 func (c *Client) Distinct(ctx context.Context, dbName, collName string, fieldName string, filter interface{}) ([]interface{}, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	return collection.Distinct(ctx, fieldName, filter)
+	op := &OpInfo{Name: "distinct", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) ([]interface{}, error) {
+		return collection.Distinct(ctx, fieldName, op.Filter)
+	})
 }
 
 // UpdateOne 该方法用于更新集合中符合筛选条件的第一个文档。
 func (c *Client) UpdateOne(ctx context.Context, dbName, collName string, filter interface{}, data interface{}) (*mongo.UpdateResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	return collection.UpdateOne(ctx, filter, data)
+	op := &OpInfo{Name: "updateOne", Database: dbName, Collection: collName, Filter: filter, Update: data}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return collection.UpdateOne(ctx, op.Filter, op.Update)
+	})
 }
 
 // UpdateMany 该方法用于更新集合中符合筛选条件的所有文档。
 func (c *Client) UpdateMany(ctx context.Context, dbName, collName string, filter interface{}, data interface{}) (*mongo.UpdateResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	return collection.UpdateMany(ctx, filter, data)
+	op := &OpInfo{Name: "updateMany", Database: dbName, Collection: collName, Filter: filter, Update: data}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return collection.UpdateMany(ctx, op.Filter, op.Update)
+	})
 }
 
 // UpdateByID 该方法用于根据文档的 _id 字段更新集合中的特定文档。
 func (c *Client) UpdateByID(ctx context.Context, dbName, collName string, id interface{}, data interface{}) (*mongo.UpdateResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	return collection.UpdateByID(ctx, id, data)
+	op := &OpInfo{Name: "updateByID", Database: dbName, Collection: collName, Filter: bson.D{{Key: "_id", Value: id}}, Update: data}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return collection.UpdateOne(ctx, op.Filter, op.Update)
+	})
 }
 
 // UpdateOneWithSession 该方法用于在一个会话中执行更新集合中符合筛选条件的第一个文档，具有强一致性。
 func (c *Client) UpdateOneWithSession(ctx context.Context, dbName, collName string, filter interface{}, data interface{}) error {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-
-	var (
-		session mongo.Session
-		err     error
-	)
-	session, err = c.RealCli.StartSession()
-	if err != nil {
-		return err
-	}
-	if err = session.StartTransaction(); err != nil {
-		return err
-	}
-	f := func(sessionContext mongo.SessionContext) error {
-		_, err = collection.UpdateOne(sessionContext, filter, data)
-		if err != nil {
+	return c.WithTransaction(ctx, func(txCtx mongo.SessionContext) error {
+		op := &OpInfo{Name: "updateOne", Database: dbName, Collection: collName, Filter: filter, Update: data}
+		return c.do(txCtx, op, func(ctx context.Context) error {
+			_, err := collection.UpdateOne(ctx, op.Filter, op.Update)
 			return err
-		}
-		err = session.CommitTransaction(sessionContext)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-	err = mongo.WithSession(ctx, session, f)
-	if err != nil {
-		return err
-	}
-	session.EndSession(ctx)
-	return nil
+		})
+	})
 }
 
 func (c *Client) UpdateManyWithSession(ctx context.Context, dbName, collName string, filter interface{}, data interface{}) error {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-
-	var (
-		session mongo.Session
-		err     error
-	)
-	session, err = c.RealCli.StartSession()
-	if err != nil {
-		return err
-	}
-	if err = session.StartTransaction(); err != nil {
-		return err
-	}
-	f := func(sessionContext mongo.SessionContext) error {
-		_, err = collection.UpdateMany(sessionContext, filter, data)
-		if err != nil {
+	return c.WithTransaction(ctx, func(txCtx mongo.SessionContext) error {
+		op := &OpInfo{Name: "updateMany", Database: dbName, Collection: collName, Filter: filter, Update: data}
+		return c.do(txCtx, op, func(ctx context.Context) error {
+			_, err := collection.UpdateMany(ctx, op.Filter, op.Update)
 			return err
-		}
-		err = session.CommitTransaction(sessionContext)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-	err = mongo.WithSession(ctx, session, f)
-	if err != nil {
-		return err
-	}
-	session.EndSession(ctx)
-	return nil
+		})
+	})
 }
 
 func (c *Client) UpdateByIDWithSession(ctx context.Context, dbName, collName string, id interface{}, data interface{}) error {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-
-	var (
-		session mongo.Session
-		err     error
-	)
-	session, err = c.RealCli.StartSession()
-	if err != nil {
-		return err
-	}
-	if err = session.StartTransaction(); err != nil {
-		return err
-	}
-	f := func(sessionContext mongo.SessionContext) error {
-		_, err = collection.UpdateByID(sessionContext, id, data)
-		if err != nil {
+	return c.WithTransaction(ctx, func(txCtx mongo.SessionContext) error {
+		op := &OpInfo{Name: "updateByID", Database: dbName, Collection: collName, Filter: bson.D{{Key: "_id", Value: id}}, Update: data}
+		return c.do(txCtx, op, func(ctx context.Context) error {
+			_, err := collection.UpdateOne(ctx, op.Filter, op.Update)
 			return err
-		}
-		err = session.CommitTransaction(sessionContext)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-	err = mongo.WithSession(ctx, session, f)
-	if err != nil {
-		return err
-	}
-	session.EndSession(ctx)
-	return nil
+		})
+	})
+}
+
+// FindOneAndUpdateWithOption 该方法用于原子地更新符合筛选条件的第一个文档并返回它，
+// 通过选项可以设置 Upsert 以及返回更新前还是更新后的文档。
+func (c *Client) FindOneAndUpdateWithOption(ctx context.Context, dbName, collName string, filter interface{}, update interface{},
+	updateOptions *options.FindOneAndUpdateOptions) *SingleResult {
+	collection := c.RealCli.Database(dbName).Collection(collName)
+	op := &OpInfo{Name: "findOneAndUpdate", Database: dbName, Collection: collName, Filter: filter, Update: update}
+	return c.singleResult(ctx, op, func(ctx context.Context) *mongo.SingleResult {
+		return collection.FindOneAndUpdate(ctx, op.Filter, op.Update, updateOptions)
+	})
 }
 
 // ReplaceOne 该方法用于在集合中替换（Replace）符合筛选条件的第一个文档。
 func (c *Client) ReplaceOne(ctx context.Context, dbName, collName string, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	result, err := collection.ReplaceOne(ctx, filter, replacement)
+	op := &OpInfo{Name: "replaceOne", Database: dbName, Collection: collName, Filter: filter, Update: replacement}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return collection.ReplaceOne(ctx, op.Filter, op.Update)
+	})
+}
 
-	return result, err
+// ReplaceOneWithOption 该方法用于带选项地替换符合筛选条件的第一个文档，例如通过 SetUpsert 在文档不存在时插入。
+func (c *Client) ReplaceOneWithOption(ctx context.Context, dbName, collName string, filter interface{}, replacement interface{},
+	replaceOptions *options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	collection := c.RealCli.Database(dbName).Collection(collName)
+	op := &OpInfo{Name: "replaceOne", Database: dbName, Collection: collName, Filter: filter, Update: replacement}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return collection.ReplaceOne(ctx, op.Filter, op.Update, replaceOptions)
+	})
 }
 
 func (c *Client) DeleteOne(ctx context.Context, dbName, collName string, filter interface{}) (*mongo.DeleteResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	return collection.DeleteOne(ctx, filter)
+	op := &OpInfo{Name: "deleteOne", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.DeleteResult, error) {
+		return collection.DeleteOne(ctx, op.Filter)
+	})
 }
 
 func (c *Client) DeleteMany(ctx context.Context, dbName, collName string, filter interface{}) (*mongo.DeleteResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	return collection.DeleteMany(ctx, filter)
+	op := &OpInfo{Name: "deleteMany", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.DeleteResult, error) {
+		return collection.DeleteMany(ctx, op.Filter)
+	})
 }
 
 func (c *Client) Count(ctx context.Context, dbName, collName string, filter interface{}) (int64, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	return collection.CountDocuments(ctx, filter)
+	op := &OpInfo{Name: "count", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) (int64, error) {
+		return collection.CountDocuments(ctx, op.Filter)
+	})
 }
 
 func (c *Client) ChangeStreamClient(client *mongo.Client, coll *mongo.Collection) {
@@ -222,81 +214,113 @@ func (c *Client) ChangeStreamDB(client *mongo.Client, coll *mongo.Collection) {
 // UploadGridFS 将数据上传到 MongoDB 的 GridFS 中。
 // bucketOptions：GridFS 存储桶的选项，用于配置存储桶的行为，例如指定文件块大小、元数据等。
 func (c *Client) UploadGridFS(ctx context.Context, filename string, data interface{}, db *mongo.Database, bucketOptions *options.BucketOptions) error {
+	op := &OpInfo{Name: "uploadGridFS", Database: db.Name(), Collection: gridFSBucketName(bucketOptions), Documents: []interface{}{data}}
 	bucket, err := gridfs.NewBucket(db, bucketOptions)
 	if err != nil {
-		return err
-	}
-	opts := options.GridFSUpload()
-	//opts.SetMetadata(bsonx.Doc{{Key: "content-type", Value: bsonx.String("application/json")}})
-	var upLoadStream *gridfs.UploadStream
-	if upLoadStream, err = bucket.OpenUploadStream(filename, opts); err != nil {
-		return err
+		return wrapError(op.Name, op.Database, op.Collection, err)
 	}
 	str, err := jsoniter.MarshalToString(data)
 	if err != nil {
 		return err
 	}
-	if _, err = upLoadStream.Write([]byte(str)); err != nil {
-		return err
-	}
-	upLoadStream.Close()
-	return nil
+	// 每次上传都会新建一个文件，失败后不能重试
+	return c.do(NoRetry(ctx), op, func(ctx context.Context) error {
+		opts := options.GridFSUpload()
+		//opts.SetMetadata(bsonx.Doc{{Key: "content-type", Value: bsonx.String("application/json")}})
+		upLoadStream, err := bucket.OpenUploadStream(filename, opts)
+		if err != nil {
+			return err
+		}
+		if _, err = upLoadStream.Write([]byte(str)); err != nil {
+			return err
+		}
+		return upLoadStream.Close()
+	})
 }
 
 // DownLoadGridFS 从 GridFS 中下载文件。
 // 返回的是一个字符串类型
 func (c *Client) DownLoadGridFS(ctx context.Context, fileID interface{}, db *mongo.Database, bucketOptions *options.BucketOptions) (string, error) {
+	op := &OpInfo{Name: "downloadGridFS", Database: db.Name(), Collection: gridFSBucketName(bucketOptions), Filter: bson.D{{Key: "_id", Value: fileID}}}
 	bucket, err := gridfs.NewBucket(db, bucketOptions)
 	if err != nil {
-		return "", err
+		return "", wrapError(op.Name, op.Database, op.Collection, err)
 	}
 	var b bytes.Buffer
-	w := bufio.NewWriter(&b)
-	if _, err = bucket.DownloadToStream(fileID, w); err != nil {
+	err = c.do(ctx, op, func(ctx context.Context) error {
+		b.Reset()
+		w := bufio.NewWriter(&b)
+		if _, err := bucket.DownloadToStream(fileID, w); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+	if err != nil {
 		return "", err
 	}
-	return b.String(), err
+	return b.String(), nil
+}
+
+// gridFSBucketName 返回 GridFS 存储桶的名字，默认为 fs。
+func gridFSBucketName(bucketOptions *options.BucketOptions) string {
+	if bucketOptions != nil && bucketOptions.Name != nil {
+		return *bucketOptions.Name
+	}
+	return options.DefaultName
 }
 
 // EstimatedDocumentCount You can get an approximation on the number of documents in a collection
 func (c *Client) EstimatedDocumentCount(ctx context.Context, dbName, collName string) (int64, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	estCount, estCountErr := collection.EstimatedDocumentCount(ctx)
-	return estCount, estCountErr
+	op := &OpInfo{Name: "estimatedDocumentCount", Database: dbName, Collection: collName}
+	return call(ctx, c, op, func(ctx context.Context) (int64, error) {
+		return collection.EstimatedDocumentCount(ctx)
+	})
 }
 
 // CountDocuments You can get an exact number of documents in a collection
 func (c *Client) CountDocuments(ctx context.Context, dbName, collName string, filter interface{}) (int64, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	estCount, estCountErr := collection.CountDocuments(ctx, filter)
-	return estCount, estCountErr
+	op := &OpInfo{Name: "countDocuments", Database: dbName, Collection: collName, Filter: filter}
+	return call(ctx, c, op, func(ctx context.Context) (int64, error) {
+		return collection.CountDocuments(ctx, op.Filter)
+	})
 }
 
 // RunCommand 在指定的数据库上运行一个命令，并返回结果。
 func (c *Client) RunCommand(ctx context.Context, dbName string, command interface{}) (bson.M, error) {
 	db := c.RealCli.Database(dbName)
 	var result bson.M
-	err := db.RunCommand(ctx, command).Decode(&result)
+	op := &OpInfo{Name: "runCommand", Database: dbName, Command: command}
+	err := c.do(ctx, op, func(ctx context.Context) error {
+		return db.RunCommand(ctx, op.Command).Decode(&result)
+	})
 	return result, err
 }
 
 // BulkWrite 执行批量写入操作。
 func (c *Client) BulkWrite(ctx context.Context, dbName, collName string, models []mongo.WriteModel, opts *options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
-	results, err := collection.BulkWrite(ctx, models, opts)
-	return results, err
+	op := &OpInfo{Name: "bulkWrite", Database: dbName, Collection: collName}
+	return call(ctx, c, op, func(ctx context.Context) (*mongo.BulkWriteResult, error) {
+		return collection.BulkWrite(ctx, models, opts)
+	})
 }
 
 func (c *Client) CreateIndex(ctx context.Context, dbName, collName string, indexModel mongo.IndexModel) (string, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	name, err := collection.Indexes().CreateOne(ctx, indexModel)
-	return name, err
+	op := &OpInfo{Name: "createIndex", Database: dbName, Collection: collName}
+	return call(ctx, c, op, func(ctx context.Context) (string, error) {
+		return collection.Indexes().CreateOne(ctx, indexModel)
+	})
 }
 
 func (c *Client) DropIndex(ctx context.Context, dbName, collName string, indexName string) (bson.Raw, error) {
 	collection := c.RealCli.Database(dbName).Collection(collName)
 
-	res, err := collection.Indexes().DropOne(ctx, indexName)
-	return res, err
+	op := &OpInfo{Name: "dropIndex", Database: dbName, Collection: collName}
+	return call(ctx, c, op, func(ctx context.Context) (bson.Raw, error) {
+		return collection.Indexes().DropOne(ctx, indexName)
+	})
 }
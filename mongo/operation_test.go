@@ -40,7 +40,7 @@ func TestAggregate(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -103,7 +103,7 @@ func TestInsertOne(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -143,7 +143,7 @@ func TestInsertMany(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -196,7 +196,7 @@ func TestFindOne(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -253,7 +253,7 @@ func TestFind(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -311,7 +311,7 @@ func TestFindWithOptio(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -380,7 +380,7 @@ func TestDistinct(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -425,7 +425,7 @@ func TestUpdateOne(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -475,7 +475,7 @@ func TestUpdateMany(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -525,7 +525,7 @@ func TestUpdateByID(t *testing.T) {
 	to := &testOwner{}
 	tc := &Client{
 		BaseComponent: alphaBroker.NewBaseComponent(),
-		RealCli: NewClient(ctx, &Config{
+		RealCli: mustNewClient(t, ctx, &Config{
 			URI:         "mongodb://localhost:27017",
 			MinPoolSize: 3,
 			MaxPoolSize: 3000,
@@ -576,7 +576,7 @@ func TestUpdateByID(t *testing.T) {
 // 	to := &testOwner{}
 // 	tc := &Client{
 // 		BaseComponent: alphaBroker.NewBaseComponent(),
-// 		RealCli: NewClient(ctx, &Config{
+// 		RealCli: mustNewClient(t, ctx, &Config{
 // 			URI:         "mongodb://localhost:27017",
 // 			MinPoolSize: 3,
 // 			MaxPoolSize: 3000,
@@ -0,0 +1,136 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository 绑定一个数据库和集合，在 Client 的操作之上提供按类型 T 解码的读写方法。
+// 读操作的 filter 为 nil 时匹配集合中的所有文档，写操作的 filter 不能为 nil，
+// 需要修改所有文档时显式传入 bson.M{}。
+type Repository[T any] struct {
+	Client   *Client
+	DBName   string
+	CollName string
+}
+
+func NewRepository[T any](client *Client, dbName, collName string) *Repository[T] {
+	return &Repository[T]{Client: client, DBName: dbName, CollName: collName}
+}
+
+var (
+	// ErrNilFilter 是写操作的 filter 为 nil 时返回的错误。
+	ErrNilFilter = errors.New("mongo: nil filter on write")
+	// ErrInvalidPage 是 FindPage 的 page 小于 1 或者 pageSize 不大于 0 时返回的错误。
+	ErrInvalidPage = errors.New("mongo: invalid page")
+)
+
+// Page 是 FindPage 返回的一页文档，Total 是符合条件的文档总数。
+type Page[T any] struct {
+	Items    []T
+	Total    int64
+	Page     int64
+	PageSize int64
+}
+
+func orAll(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.M{}
+	}
+	return filter
+}
+
+// Get 根据 _id 获取文档，文档不存在时返回的错误分类为 ErrNotFound。
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (T, error) {
+	var doc T
+	err := r.Client.FindOne(ctx, r.DBName, r.CollName, bson.M{"_id": id}).Decode(&doc)
+	return doc, err
+}
+
+// FindAll 返回符合筛选条件的所有文档。
+func (r *Repository[T]) FindAll(ctx context.Context, filter interface{}) ([]T, error) {
+	cursor, err := r.Client.Find(ctx, r.DBName, r.CollName, orAll(filter))
+	if err != nil {
+		return nil, err
+	}
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// FindPage 按 sort 排序返回第 page 页（从 1 开始）的文档以及符合条件的文档总数。
+func (r *Repository[T]) FindPage(ctx context.Context, filter interface{}, sort interface{}, page, pageSize int64) (*Page[T], error) {
+	if page < 1 || pageSize <= 0 {
+		return nil, fmt.Errorf("%w: page %d, page size %d", ErrInvalidPage, page, pageSize)
+	}
+	filter = orAll(filter)
+	total, err := r.Client.Count(ctx, r.DBName, r.CollName, filter)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSkip((page - 1) * pageSize).SetLimit(pageSize)
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+	cursor, err := r.Client.FindWithOption(ctx, r.DBName, r.CollName, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := []T{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return &Page[T]{Items: items, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// Insert 插入文档并返回它的 _id。
+func (r *Repository[T]) Insert(ctx context.Context, doc T) (interface{}, error) {
+	res, err := r.Client.InsertOne(ctx, r.DBName, r.CollName, doc)
+	if err != nil {
+		return nil, err
+	}
+	return res.InsertedID, nil
+}
+
+// Upsert 用 doc 替换符合筛选条件的第一个文档，不存在时插入。
+func (r *Repository[T]) Upsert(ctx context.Context, filter interface{}, doc T) (*mongo.UpdateResult, error) {
+	if filter == nil {
+		return nil, ErrNilFilter
+	}
+	return r.Client.ReplaceOneWithOption(ctx, r.DBName, r.CollName, filter, doc, options.Replace().SetUpsert(true))
+}
+
+// Update 更新符合筛选条件的第一个文档，返回匹配到的文档数。
+func (r *Repository[T]) Update(ctx context.Context, filter interface{}, update interface{}) (int64, error) {
+	if filter == nil {
+		return 0, ErrNilFilter
+	}
+	res, err := r.Client.UpdateOne(ctx, r.DBName, r.CollName, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+// Delete 删除符合筛选条件的所有文档，返回删除的文档数。
+func (r *Repository[T]) Delete(ctx context.Context, filter interface{}) (int64, error) {
+	if filter == nil {
+		return 0, ErrNilFilter
+	}
+	res, err := r.Client.DeleteMany(ctx, r.DBName, r.CollName, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (r *Repository[T]) Count(ctx context.Context, filter interface{}) (int64, error) {
+	return r.Client.Count(ctx, r.DBName, r.CollName, orAll(filter))
+}
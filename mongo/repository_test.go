@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Book struct {
+	ID    string  `bson:"_id"`
+	Title string  `bson:"title"`
+	Price float64 `bson:"price"`
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	to := &testOwner{}
+	tc := &Client{
+		BaseComponent: alphaBroker.NewBaseComponent(),
+		RealCli: mustNewClient(t, ctx, &Config{
+			URI:         "mongodb://localhost:27017",
+			MinPoolSize: 3,
+			MaxPoolSize: 3000,
+			Credential: options.Credential{
+				Username: "alpha",
+				Password: "883721",
+			},
+		}),
+	}
+	defer tc.RealCli.Disconnect(ctx)
+
+	to.c = tc
+	to.Launch()
+	defer to.Stop()
+
+	books := NewRepository[Book](tc, "alpha_app", "books")
+	f := alphaBroker.Submit(ctx, tc, func(ctx context.Context) (struct{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if _, err := books.Delete(ctx, bson.M{}); err != nil {
+			return struct{}{}, err
+		}
+		for i, title := range []string{"a", "b", "c", "d", "e"} {
+			if _, err := books.Insert(ctx, Book{ID: title, Title: title, Price: float64(i)}); err != nil {
+				return struct{}{}, err
+			}
+		}
+		if b, err := books.Get(ctx, "c"); err != nil || b.Price != 2 {
+			return struct{}{}, fmt.Errorf("got %v %v", b, err)
+		}
+		page, err := books.FindPage(ctx, bson.M{"price": bson.M{"$gte": 1}}, bson.M{"price": -1}, 2, 2)
+		if err != nil || page.Total != 4 || len(page.Items) != 2 || page.Items[0].ID != "c" {
+			return struct{}{}, fmt.Errorf("got %+v %v", page, err)
+		}
+		if n, err := books.Update(ctx, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"price": 10}}); err != nil || n != 1 {
+			return struct{}{}, fmt.Errorf("got %d %v", n, err)
+		}
+		if _, err := books.Upsert(ctx, bson.M{"_id": "f"}, Book{ID: "f", Title: "f", Price: 5}); err != nil {
+			return struct{}{}, err
+		}
+		all, err := books.FindAll(ctx, bson.M{"price": bson.M{"$gte": 5}})
+		if err != nil || len(all) != 2 {
+			return struct{}{}, fmt.Errorf("got %v %v", all, err)
+		}
+		if n, err := books.Count(ctx, nil); err != nil || n != 6 {
+			return struct{}{}, fmt.Errorf("got %d %v", n, err)
+		}
+		return struct{}{}, nil
+	})
+	if _, err := f.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepositoryValidation(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository[Book](&Client{}, "test", "books")
+	if _, err := repo.Delete(ctx, nil); !errors.Is(err, ErrNilFilter) {
+		t.Fatal(err)
+	}
+	if _, err := repo.Update(ctx, nil, bson.M{"$set": bson.M{"price": 1}}); !errors.Is(err, ErrNilFilter) {
+		t.Fatal(err)
+	}
+	if _, err := repo.Upsert(ctx, nil, Book{ID: "b1"}); !errors.Is(err, ErrNilFilter) {
+		t.Fatal(err)
+	}
+	for _, c := range [][2]int64{{0, 10}, {-1, 10}, {1, 0}, {1, -5}} {
+		if _, err := repo.FindPage(ctx, nil, nil, c[0], c[1]); !errors.Is(err, ErrInvalidPage) {
+			t.Fatalf("page %d, size %d: %v", c[0], c[1], err)
+		}
+	}
+}
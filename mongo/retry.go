@@ -0,0 +1,352 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBackoff     = 100 * time.Millisecond
+	DefaultRetryMaxBackoff  = 2 * time.Second
+
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenTimeout      = 10 * time.Second
+)
+
+// ErrCircuitOpen 是熔断器打开时操作直接返回的错误。
+var ErrCircuitOpen = errors.New("mongo: circuit breaker open")
+
+// DefaultRetryLabels 是默认重试的错误标签：服务端表明写操作可以安全重试的错误，以及网络错误。
+var DefaultRetryLabels = []string{"RetryableWriteError", "NetworkError"}
+
+// RetryPolicy 是 Client 方法的重试策略，只有带有 Labels 中标签的错误会被重试。
+// 默认只重试读操作。写操作的每次重试都是一次新的执行，没有 _id 的 InsertOne
+// 会插入重复的文档，$inc 会被执行两次，所以写操作和 RunCommand 需要用 AllowRetry
+// 开启重试，任何操作都可以用 NoRetry 关闭重试。事务中的操作不会被单独重试，由 WithTransaction 重试整个事务。
+type RetryPolicy struct {
+	// MaxAttempts 是包括第一次在内的最多执行次数。
+	MaxAttempts int
+	// Backoff 是第一次重试前的等待时间，之后每次翻倍直到 MaxBackoff，
+	// 实际等待时间在其一半到全部之间随机。
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Labels     []string
+}
+
+func (p *RetryPolicy) defaults() {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultRetryBackoff
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if p.Labels == nil {
+		p.Labels = DefaultRetryLabels
+	}
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	for _, label := range p.Labels {
+		if hasErrorLabel(err, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 返回第 attempt 次执行失败后的等待时间。
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := alphaBroker.Backoff(p.Backoff, p.MaxBackoff, attempt)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retriedOps 是默认重试的操作，都是读操作。
+var retriedOps = map[string]bool{
+	"find":                   true,
+	"findOne":                true,
+	"aggregate":              true,
+	"distinct":               true,
+	"count":                  true,
+	"countDocuments":         true,
+	"estimatedDocumentCount": true,
+	"downloadGridFS":         true,
+}
+
+type noRetryKey struct{}
+
+type allowRetryKey struct{}
+
+// NoRetry 返回的 ctx 执行的操作失败时不会被重试。
+func NoRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// AllowRetry 返回的 ctx 执行的操作按重试策略重试，包括默认不重试的操作，
+// 调用方需要保证操作重复执行是安全的。
+func AllowRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowRetryKey{}, true)
+}
+
+type BreakerState int32
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig 是熔断器的配置。连续 FailureThreshold 次操作因为网络错误、
+// 超时或者主节点不可用而失败后熔断器打开，之后的操作直接返回 ErrCircuitOpen；
+// OpenTimeout 之后熔断器半开，放行一个操作试探，成功则关闭，失败则重新打开。
+type BreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func (c *BreakerConfig) defaults() {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+}
+
+type breaker struct {
+	conf  BreakerConfig
+	now   func() time.Time
+	stats *clientStats
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(conf BreakerConfig, stats *clientStats) *breaker {
+	conf.defaults()
+	return &breaker{conf: conf, now: time.Now, stats: stats}
+}
+
+// allow 报告操作能否执行，半开时只放行一个试探的操作。
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.conf.OpenTimeout {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record 记录一次操作的结果，failed 表示集群不健康。
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.conf.FailureThreshold {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.setState(BreakerClosed)
+	}
+}
+
+// abandon 记录一次因为调用方 ctx 结束而没有结果的操作，这不能说明集群是否健康：
+// 半开时状态不变，放行下一个试探的操作。
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+}
+
+func (b *breaker) setState(state BreakerState) {
+	b.state = state
+	b.stats.breakerState.Store(int32(state))
+	switch state {
+	case BreakerClosed:
+		b.stats.breakerClosed.Add(1)
+	case BreakerOpen:
+		b.stats.breakerOpened.Add(1)
+	case BreakerHalfOpen:
+		b.stats.breakerHalfOpened.Add(1)
+	}
+}
+
+// unhealthy 报告错误是否说明集群不健康，调用方自己的 ctx 结束不算。
+func unhealthy(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	kind := classify(err)
+	return kind == ErrNetwork || kind == ErrTimeout || hasErrorLabel(err, "RetryableWriteError")
+}
+
+// ClientStats 是重试和熔断的计数。
+type ClientStats struct {
+	Retries           uint64
+	BreakerState      BreakerState
+	BreakerOpened     uint64
+	BreakerHalfOpened uint64
+	BreakerClosed     uint64
+}
+
+type clientStats struct {
+	retries           atomic.Uint64
+	breakerState      atomic.Int32
+	breakerOpened     atomic.Uint64
+	breakerHalfOpened atomic.Uint64
+	breakerClosed     atomic.Uint64
+}
+
+// SetRetryPolicy 设置 Client 方法的重试策略，需要在使用 Client 之前设置，默认不重试。
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	policy.defaults()
+	c.retry = &policy
+}
+
+// SetBreaker 设置 Client 方法的熔断器，需要在使用 Client 之前设置，默认没有熔断器。
+func (c *Client) SetBreaker(conf BreakerConfig) {
+	c.breaker = newBreaker(conf, &c.stats)
+}
+
+// Stats 返回重试和熔断的计数。
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		Retries:           c.stats.retries.Load(),
+		BreakerState:      BreakerState(c.stats.breakerState.Load()),
+		BreakerOpened:     c.stats.breakerOpened.Load(),
+		BreakerHalfOpened: c.stats.breakerHalfOpened.Load(),
+		BreakerClosed:     c.stats.breakerClosed.Load(),
+	}
+}
+
+// do 经过拦截器执行一次操作，返回的错误是 *Error。
+func (c *Client) do(ctx context.Context, op *OpInfo, fn func(ctx context.Context) error) error {
+	err := c.intercept(ctx, op, func(ctx context.Context) error {
+		return c.execute(ctx, op, fn)
+	})
+	return wrapError(op.Name, op.Database, op.Collection, err)
+}
+
+// execute 执行操作并把结果记录在 op 中，熔断器打开时直接返回 ErrCircuitOpen，
+// 可重试的错误按重试策略重试。
+func (c *Client) execute(ctx context.Context, op *OpInfo, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	op.Err = c.retryLoop(ctx, op, fn)
+	op.Duration = time.Since(start)
+	return op.Err
+}
+
+func (c *Client) retryLoop(ctx context.Context, op *OpInfo, fn func(ctx context.Context) error) error {
+	policy := c.retry
+	switch {
+	case ctx.Value(noRetryKey{}) != nil || mongo.SessionFromContext(ctx) != nil:
+		policy = nil
+	case !retriedOps[op.Name] && ctx.Value(allowRetryKey{}) == nil:
+		policy = nil
+	}
+	for op.Attempts = 1; ; op.Attempts++ {
+		if c.breaker != nil && !c.breaker.allow() {
+			op.Attempts--
+			return wrapError(op.Name, op.Database, op.Collection, ErrCircuitOpen)
+		}
+		err := fn(ctx)
+		if c.breaker != nil {
+			if err != nil && ctx.Err() != nil {
+				c.breaker.abandon()
+			} else {
+				c.breaker.record(unhealthy(ctx, err))
+			}
+		}
+		if err == nil || policy == nil || op.Attempts >= policy.MaxAttempts || !policy.retryable(err) {
+			return wrapError(op.Name, op.Database, op.Collection, err)
+		}
+		c.stats.retries.Add(1)
+		select {
+		case <-ctx.Done():
+			return wrapError(op.Name, op.Database, op.Collection, err)
+		case <-time.After(policy.backoff(op.Attempts)):
+		}
+	}
+}
+
+// call 是返回结果的 do。
+func call[T any](ctx context.Context, c *Client, op *OpInfo, fn func(ctx context.Context) (T, error)) (T, error) {
+	var res T
+	err := c.do(ctx, op, func(ctx context.Context) (err error) {
+		res, err = fn(ctx)
+		return err
+	})
+	return res, err
+}
+
+// singleResult 是返回 SingleResult 的 do，没有找到文档不算失败。
+func (c *Client) singleResult(ctx context.Context, op *OpInfo, fn func(ctx context.Context) *mongo.SingleResult) *SingleResult {
+	var sr *mongo.SingleResult
+	err := c.do(ctx, op, func(ctx context.Context) error {
+		sr = fn(ctx)
+		if err := sr.Err(); !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		return nil
+	})
+	if sr == nil || err != nil && sr.Err() == nil {
+		// 操作没有执行，或者拦截器返回了错误
+		sr = mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return &SingleResult{sr, op.Name, op.Database, op.Collection}
+}
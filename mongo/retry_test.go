@@ -0,0 +1,153 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	errNotPrimary = mongo.CommandError{Code: 10107, Name: "NotWritablePrimary", Labels: []string{"RetryableWriteError"}}
+	errNetwork    = mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+)
+
+func ordersOp(name string) *OpInfo {
+	return &OpInfo{Name: name, Database: "app", Collection: "orders"}
+}
+
+// failing returns an operation failing with errs in turn, then succeeding.
+func failing(calls *int, errs ...error) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if len(errs) == 0 {
+			return nil
+		}
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}
+}
+
+func TestRetry(t *testing.T) {
+	c := &Client{}
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	ctx := context.Background()
+
+	calls := 0
+	if err := c.do(ctx, ordersOp("find"), failing(&calls, errNotPrimary, errNetwork)); err != nil || calls != 3 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	calls = 0
+	err := c.do(ctx, ordersOp("find"), failing(&calls, errNetwork, errNetwork, errNetwork))
+	if !errors.Is(err, ErrNetwork) || calls != 3 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	calls = 0
+	dup := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}
+	if err := c.do(ctx, ordersOp("insertOne"), failing(&calls, dup)); !errors.Is(err, ErrDuplicateKey) || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	calls = 0
+	if err := c.do(NoRetry(ctx), ordersOp("find"), failing(&calls, errNetwork)); err == nil || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+
+	// a write running twice may apply twice, it is retried only when allowed
+	for _, name := range []string{"insertOne", "updateOne", "updateMany"} {
+		calls = 0
+		if err := c.do(ctx, ordersOp(name), failing(&calls, errNetwork)); !errors.Is(err, ErrNetwork) || calls != 1 {
+			t.Fatalf("%s: got %v after %d calls", name, err, calls)
+		}
+	}
+	calls = 0
+	if err := c.do(AllowRetry(ctx), ordersOp("updateMany"), failing(&calls, errNetwork)); err != nil || calls != 2 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	if got := c.Stats().Retries; got != 5 {
+		t.Fatalf("got %d retries", got)
+	}
+
+	// without policy nothing is retried
+	calls = 0
+	if err := (&Client{}).do(ctx, ordersOp("find"), failing(&calls, errNetwork)); err == nil || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	p.defaults()
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt + 1); d < max/2 || d > max {
+				t.Fatalf("attempt %d: backoff %v", attempt+1, d)
+			}
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &Client{}
+	c.SetBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second})
+	c.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// the errors of a healthy cluster do not count
+	calls := 0
+	c.do(ctx, ordersOp("insertOne"), failing(&calls, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}))
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	c.do(ctx, ordersOp("find"), failing(&calls))
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	if c.Stats().BreakerState != BreakerClosed {
+		t.Fatal(c.Stats())
+	}
+	c.do(ctx, ordersOp("find"), failing(&calls, errNotPrimary))
+	if c.Stats().BreakerState != BreakerOpen {
+		t.Fatal(c.Stats())
+	}
+
+	calls = 0
+	err := c.do(ctx, ordersOp("find"), failing(&calls))
+	if !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+	var doc bson.M
+	if err := c.singleResult(ctx, ordersOp("findOne"), nil).Decode(&doc); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal(err)
+	}
+
+	// a failed probe opens the breaker again, a successful one closes it
+	now = now.Add(time.Second)
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	if c.Stats().BreakerState != BreakerOpen || calls != 1 {
+		t.Fatal(c.Stats(), calls)
+	}
+	now = now.Add(time.Second)
+	if !c.breaker.allow() || c.breaker.allow() {
+		t.Fatal("half-open breaker let more than one probe")
+	}
+	c.breaker.record(false)
+
+	// a probe cut short by its caller leaves the breaker half-open
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	c.do(ctx, ordersOp("find"), failing(&calls, errNetwork))
+	now = now.Add(time.Second)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	c.do(canceled, ordersOp("find"), failing(&calls, context.Canceled))
+	if c.Stats().BreakerState != BreakerHalfOpen || calls != 1 {
+		t.Fatal(c.Stats(), calls)
+	}
+	c.do(ctx, ordersOp("find"), failing(&calls))
+	want := ClientStats{BreakerState: BreakerClosed, BreakerOpened: 3, BreakerHalfOpened: 3, BreakerClosed: 2}
+	if got := c.Stats(); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,428 @@
+package mongo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultSlowQueryThreshold = 100 * time.Millisecond
+	DefaultExplainInterval    = time.Minute
+	DefaultExplainTimeout     = 10 * time.Second
+	DefaultExplainQueueSize   = 64
+	DefaultSlowQueryMaxShapes = 1000
+)
+
+// SlowQueryConfig 是慢查询分析的配置。
+type SlowQueryConfig struct {
+	// Threshold 是慢查询的执行时间，包括重试。
+	Threshold time.Duration
+	// ExplainInterval 内同一形状的查询只 explain 一次。
+	ExplainInterval time.Duration
+	ExplainTimeout  time.Duration
+	// QueueSize 是等待 explain 的查询数，队列满时放弃这次 explain。
+	QueueSize int
+	// MaxShapes 是记录的查询形状数，超过之后新形状的慢查询不再记录。
+	MaxShapes int
+}
+
+func (c *SlowQueryConfig) defaults() {
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultSlowQueryThreshold
+	}
+	if c.ExplainInterval <= 0 {
+		c.ExplainInterval = DefaultExplainInterval
+	}
+	if c.ExplainTimeout <= 0 {
+		c.ExplainTimeout = DefaultExplainTimeout
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultExplainQueueSize
+	}
+	if c.MaxShapes <= 0 {
+		c.MaxShapes = DefaultSlowQueryMaxShapes
+	}
+}
+
+// ExplainPlan 是 explain 的结果。
+type ExplainPlan struct {
+	// CollScan 表示执行计划中有全表扫描。
+	CollScan bool
+	// Indexes 是执行计划使用的索引。
+	Indexes      []string
+	DocsExamined int64
+	KeysExamined int64
+	Returned     int64
+	ExplainedAt  time.Time
+}
+
+// SlowQuery 是一种形状的慢查询的统计。
+type SlowQuery struct {
+	// Shape 是值被替换为 "?" 的查询，见 OpInfo.Shape。
+	Shape      string
+	Op         string
+	Database   string
+	Collection string
+
+	Count    uint64
+	Total    time.Duration
+	Max      time.Duration
+	LastSeen time.Time
+
+	// Plan 是最近一次成功的 explain，还没有 explain 时为 nil。
+	Plan *ExplainPlan
+	// ExplainErr 是最近一次 explain 的错误。
+	ExplainErr error
+}
+
+type slowQuery struct {
+	SlowQuery
+	explainedAt time.Time
+}
+
+type explainJob struct {
+	shape    string
+	database string
+	cmd      bson.Raw
+}
+
+// SlowQueryAnalyzer 记录执行时间超过阈值的 find、findOne、aggregate 和 count 操作，
+// 按查询形状归类，并在后台用 explain 查看它们的执行计划，Intercept 是它的拦截器：
+//
+//	analyzer := NewSlowQueryAnalyzer(client, SlowQueryConfig{Threshold: 200 * time.Millisecond})
+//	defer analyzer.Close()
+//	client.Use(analyzer.Intercept)
+//
+// 记录的形状中不包含查询的值，explain 执行的是原始的查询。
+type SlowQueryAnalyzer struct {
+	conf    SlowQueryConfig
+	now     func() time.Time
+	explain func(ctx context.Context, dbName string, cmd bson.Raw) (bson.Raw, error)
+
+	mu      sync.Mutex
+	queries map[string]*slowQuery
+	dropped atomic.Uint64
+
+	queue  chan *explainJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSlowQueryAnalyzer 创建慢查询分析器，用 c 执行 explain，Close 停止后台的 explain。
+func NewSlowQueryAnalyzer(c *Client, conf SlowQueryConfig) *SlowQueryAnalyzer {
+	return newSlowQueryAnalyzer(conf, func(ctx context.Context, dbName string, cmd bson.Raw) (bson.Raw, error) {
+		// 直接使用 RealCli，explain 不经过拦截器和重试
+		return c.RealCli.Database(dbName).RunCommand(ctx, cmd).Raw()
+	})
+}
+
+func newSlowQueryAnalyzer(conf SlowQueryConfig, explain func(ctx context.Context, dbName string, cmd bson.Raw) (bson.Raw, error)) *SlowQueryAnalyzer {
+	conf.defaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &SlowQueryAnalyzer{
+		conf:    conf,
+		now:     time.Now,
+		explain: explain,
+		queries: make(map[string]*slowQuery),
+		queue:   make(chan *explainJob, conf.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *SlowQueryAnalyzer) Intercept(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+	err := next(ctx)
+	if op.Duration < a.conf.Threshold || op.Attempts == 0 {
+		return err
+	}
+	cmd := explainCommand(op)
+	if cmd == nil {
+		return err
+	}
+	a.record(op, cmd)
+	return err
+}
+
+// record 记录一次慢查询，需要时把它加入 explain 的队列。
+func (a *SlowQueryAnalyzer) record(op *OpInfo, cmd bson.D) {
+	shape := op.Shape()
+	now := a.now()
+
+	a.mu.Lock()
+	q, ok := a.queries[shape]
+	if !ok {
+		if len(a.queries) >= a.conf.MaxShapes {
+			a.mu.Unlock()
+			return
+		}
+		q = &slowQuery{SlowQuery: SlowQuery{Shape: shape, Op: op.Name, Database: op.Database, Collection: op.Collection}}
+		a.queries[shape] = q
+	}
+	q.Count++
+	q.Total += op.Duration
+	if op.Duration > q.Max {
+		q.Max = op.Duration
+	}
+	q.LastSeen = now
+	explain := q.explainedAt.IsZero() || now.Sub(q.explainedAt) >= a.conf.ExplainInterval
+	if explain {
+		q.explainedAt = now
+	}
+	a.mu.Unlock()
+	if !explain {
+		return
+	}
+
+	// 查询的值可能被调用方修改，在这里编码
+	raw, err := bson.Marshal(cmd)
+	if err != nil {
+		a.mu.Lock()
+		q.ExplainErr = err
+		a.mu.Unlock()
+		return
+	}
+	select {
+	case a.queue <- &explainJob{shape: shape, database: op.Database, cmd: raw}:
+	default:
+		a.dropped.Add(1)
+		a.mu.Lock()
+		q.explainedAt = time.Time{}
+		a.mu.Unlock()
+	}
+}
+
+func (a *SlowQueryAnalyzer) run() {
+	defer close(a.done)
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case job := <-a.queue:
+			a.explainQuery(job)
+		}
+	}
+}
+
+func (a *SlowQueryAnalyzer) explainQuery(job *explainJob) {
+	ctx, cancel := context.WithTimeout(a.ctx, a.conf.ExplainTimeout)
+	defer cancel()
+	raw, err := a.explain(ctx, job.database, job.cmd)
+	var plan *ExplainPlan
+	if err == nil {
+		plan = parseExplain(raw)
+		plan.ExplainedAt = a.now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q := a.queries[job.shape]
+	q.ExplainErr = err
+	if plan != nil {
+		q.Plan = plan
+	}
+}
+
+// Report 返回总耗时最长的 n 种慢查询，按总耗时从大到小排列，n <= 0 时返回全部。
+func (a *SlowQueryAnalyzer) Report(n int) []SlowQuery {
+	a.mu.Lock()
+	report := make([]SlowQuery, 0, len(a.queries))
+	for _, q := range a.queries {
+		report = append(report, q.SlowQuery)
+	}
+	a.mu.Unlock()
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Total != report[j].Total {
+			return report[i].Total > report[j].Total
+		}
+		return report[i].Shape < report[j].Shape
+	})
+	if n > 0 && len(report) > n {
+		report = report[:n]
+	}
+	return report
+}
+
+// Dropped 返回因为队列已满而放弃的 explain 次数。
+func (a *SlowQueryAnalyzer) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close 停止后台的 explain，等待正在执行的 explain 返回。
+func (a *SlowQueryAnalyzer) Close() {
+	a.cancel()
+	<-a.done
+}
+
+// explainCommand 返回 explain 操作的命令，不支持 explain 的操作返回 nil。
+func explainCommand(op *OpInfo) bson.D {
+	filter := op.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	var cmd bson.D
+	switch op.Name {
+	case "find":
+		cmd = append(bson.D{{Key: "find", Value: op.Collection}, {Key: "filter", Value: filter}}, findOptions(op.FindOptions)...)
+	case "findOne":
+		cmd = bson.D{{Key: "find", Value: op.Collection}, {Key: "filter", Value: filter}, {Key: "limit", Value: 1}}
+	case "count", "countDocuments":
+		cmd = bson.D{{Key: "count", Value: op.Collection}, {Key: "query", Value: filter}}
+	case "aggregate":
+		pipeline := op.Pipeline
+		if pipeline == nil {
+			pipeline = bson.A{}
+		}
+		cmd = bson.D{{Key: "aggregate", Value: op.Collection}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.D{}}}
+	default:
+		return nil
+	}
+	return bson.D{{Key: "explain", Value: cmd}, {Key: "verbosity", Value: "executionStats"}}
+}
+
+// findOptions 返回 find 命令中影响查询计划的选项：sort、projection、skip、limit、hint 和 collation。
+func findOptions(opts *options.FindOptions) bson.D {
+	if opts == nil {
+		return nil
+	}
+	var doc bson.D
+	if opts.Sort != nil {
+		doc = append(doc, bson.E{Key: "sort", Value: opts.Sort})
+	}
+	if opts.Projection != nil {
+		doc = append(doc, bson.E{Key: "projection", Value: opts.Projection})
+	}
+	if opts.Skip != nil {
+		doc = append(doc, bson.E{Key: "skip", Value: *opts.Skip})
+	}
+	if opts.Limit != nil && *opts.Limit != 0 {
+		// 负数的 limit 表示只返回一批
+		limit := *opts.Limit
+		if limit < 0 {
+			limit = -limit
+		}
+		doc = append(doc, bson.E{Key: "limit", Value: limit})
+	}
+	if opts.Hint != nil {
+		doc = append(doc, bson.E{Key: "hint", Value: opts.Hint})
+	}
+	if opts.Collation != nil {
+		doc = append(doc, bson.E{Key: "collation", Value: opts.Collation.ToDocument()})
+	}
+	return doc
+}
+
+// parseExplain 从 explain 的结果中找出第一个 winningPlan 和 executionStats。
+// 聚合的结果可能在 stages 的 $cursor 中，分片集群的结果在 shards 中，新版本的 winningPlan
+// 在 queryPlan 中，所以按层次搜索，而不是按固定的路径读取。
+func parseExplain(raw bson.Raw) *ExplainPlan {
+	plan := &ExplainPlan{}
+	if winning, ok := findDocument(raw, "winningPlan"); ok {
+		walkPlan(winning, plan)
+	}
+	if stats, ok := findDocument(raw, "executionStats"); ok {
+		plan.DocsExamined, _ = stats.Lookup("totalDocsExamined").AsInt64OK()
+		plan.KeysExamined, _ = stats.Lookup("totalKeysExamined").AsInt64OK()
+		plan.Returned, _ = stats.Lookup("nReturned").AsInt64OK()
+	}
+	return plan
+}
+
+// findDocument 按层次搜索 doc 中第一个名为 key 的文档。
+func findDocument(doc bson.Raw, key string) (bson.Raw, bool) {
+	queue := []bson.Raw{doc}
+	for len(queue) > 0 {
+		elems, _ := queue[0].Elements()
+		queue = queue[1:]
+		for _, e := range elems {
+			v := e.Value()
+			if d, ok := v.DocumentOK(); ok {
+				if e.Key() == key {
+					return d, true
+				}
+				queue = append(queue, d)
+			} else if d, ok := v.ArrayOK(); ok {
+				queue = append(queue, d)
+			}
+		}
+	}
+	return nil, false
+}
+
+// walkPlan 记录执行计划中的全表扫描和使用的索引。
+func walkPlan(doc bson.Raw, plan *ExplainPlan) {
+	values, _ := doc.Values()
+	for _, v := range values {
+		if d, ok := v.DocumentOK(); ok {
+			walkPlan(d, plan)
+		} else if d, ok := v.ArrayOK(); ok {
+			walkPlan(d, plan)
+		}
+	}
+	if stage, ok := doc.Lookup("stage").StringValueOK(); ok && stage == "COLLSCAN" {
+		plan.CollScan = true
+	}
+	if index, ok := doc.Lookup("indexName").StringValueOK(); ok {
+		for _, name := range plan.Indexes {
+			if name == index {
+				return
+			}
+		}
+		plan.Indexes = append(plan.Indexes, index)
+	}
+}
+
+// Shape 返回操作的形状，用来归类相同的查询：与 String 相同，但是所有的值都替换为 "?"，
+// 文档的字段按名称排序，$in 之类由值组成的数组整个替换为 "?"，插入的文档不包括在内。
+// 查询选项影响查询计划，sort 之类的选项不同的查询是不同的形状。
+func (op *OpInfo) Shape() string {
+	s := op.Name + " " + op.Namespace()
+	doc := append(op.fields(), findOptions(op.FindOptions)...)
+	if len(doc) == 0 {
+		return s
+	}
+	t, data, err := bson.MarshalValue(doc)
+	if err != nil {
+		return s + " ?"
+	}
+	b, err := bson.MarshalExtJSON(redact(bson.RawValue{Type: t, Value: data}), false, false)
+	if err != nil {
+		return s + " ?"
+	}
+	return s + " " + string(b)
+}
+
+// redact 把值替换为 "?"，保留文档的字段名以及由文档组成的数组（例如 $and 和 pipeline）的结构。
+func redact(v bson.RawValue) interface{} {
+	if doc, ok := v.DocumentOK(); ok {
+		elems, _ := doc.Elements()
+		d := make(bson.D, 0, len(elems))
+		for _, e := range elems {
+			d = append(d, bson.E{Key: e.Key(), Value: redact(e.Value())})
+		}
+		sort.SliceStable(d, func(i, j int) bool { return d[i].Key < d[j].Key })
+		return d
+	}
+	if arr, ok := v.ArrayOK(); ok {
+		values, _ := arr.Values()
+		a := make(bson.A, 0, len(values))
+		for _, v := range values {
+			if v.Type != bsontype.EmbeddedDocument {
+				return "?"
+			}
+			a = append(a, redact(v))
+		}
+		return a
+	}
+	return "?"
+}
@@ -0,0 +1,254 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestOpInfoShape(t *testing.T) {
+	cases := []struct {
+		op   *OpInfo
+		want string
+	}{
+		{&OpInfo{Name: "find", Database: "app", Collection: "orders"}, "find app.orders"},
+		{&OpInfo{Name: "find", Database: "app", Collection: "orders",
+			Filter: bson.M{"user": "alice", "amount": bson.M{"$gt": 100}, "status": bson.M{"$in": bson.A{"paid", "sent"}}}},
+			`find app.orders {"filter":{"amount":{"$gt":"?"},"status":{"$in":"?"},"user":"?"}}`},
+		{&OpInfo{Name: "count", Database: "app", Collection: "orders",
+			Filter: bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "a", Value: 1}}, bson.D{{Key: "b", Value: bson.A{}}}}}}},
+			`count app.orders {"filter":{"$or":[{"a":"?"},{"b":[]}]}}`},
+		{&OpInfo{Name: "aggregate", Database: "app", Collection: "orders", Pipeline: mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: "user", Value: "bob"}}}},
+			{{Key: "$limit", Value: 10}},
+		}}, `aggregate app.orders {"pipeline":[{"$match":{"user":"?"}},{"$limit":"?"}]}`},
+	}
+	for _, c := range cases {
+		if got := c.op.Shape(); got != c.want {
+			t.Fatalf("got %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	filter := bson.D{{Key: "user", Value: "alice"}}
+	op := &OpInfo{Name: "find", Database: "app", Collection: "orders", Filter: filter,
+		FindOptions: options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetProjection(bson.D{{Key: "total", Value: 1}}).
+			SetSkip(20).SetLimit(-10).SetHint("user_1_createdAt_-1")}
+	want := bson.D{{Key: "explain", Value: bson.D{
+		{Key: "find", Value: "orders"}, {Key: "filter", Value: filter},
+		{Key: "sort", Value: bson.D{{Key: "createdAt", Value: -1}}}, {Key: "projection", Value: bson.D{{Key: "total", Value: 1}}},
+		{Key: "skip", Value: int64(20)}, {Key: "limit", Value: int64(10)}, {Key: "hint", Value: "user_1_createdAt_-1"},
+	}}, {Key: "verbosity", Value: "executionStats"}}
+	if got := explainCommand(op); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v", got)
+	}
+	plain := &OpInfo{Name: "find", Database: "app", Collection: "orders", Filter: filter}
+	if op.Shape() == plain.Shape() {
+		t.Fatalf("sorted and plain find share the shape %s", op.Shape())
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	parse := func(doc bson.D) *ExplainPlan {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseExplain(raw)
+	}
+	stats := bson.D{{Key: "nReturned", Value: 3}, {Key: "totalKeysExamined", Value: int64(3)}, {Key: "totalDocsExamined", Value: 3.0}}
+
+	// find on 7.0 with the plan in queryPlan
+	got := parse(bson.D{
+		{Key: "queryPlanner", Value: bson.D{
+			{Key: "winningPlan", Value: bson.D{{Key: "queryPlan", Value: bson.D{
+				{Key: "stage", Value: "FETCH"},
+				{Key: "inputStage", Value: bson.D{{Key: "stage", Value: "IXSCAN"}, {Key: "indexName", Value: "user_1"}}},
+			}}}},
+			{Key: "rejectedPlans", Value: bson.A{bson.D{{Key: "stage", Value: "COLLSCAN"}}}},
+		}},
+		{Key: "executionStats", Value: stats},
+	})
+	want := &ExplainPlan{Indexes: []string{"user_1"}, DocsExamined: 3, KeysExamined: 3, Returned: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+
+	// aggregate with the plan in the $cursor stage
+	got = parse(bson.D{{Key: "stages", Value: bson.A{
+		bson.D{{Key: "$cursor", Value: bson.D{
+			{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}}}},
+			{Key: "executionStats", Value: bson.D{{Key: "nReturned", Value: 2}, {Key: "totalDocsExamined", Value: 1000}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{}}},
+	}}})
+	want = &ExplainPlan{CollScan: true, DocsExamined: 1000, Returned: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+
+	// sharded find using an index on one shard and scanning the other
+	got = parse(bson.D{{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{
+		{Key: "stage", Value: "SHARD_MERGE"},
+		{Key: "shards", Value: bson.A{
+			bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "IXSCAN"}, {Key: "indexName", Value: "user_1"}}}},
+			bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}}},
+		}},
+	}}}}})
+	want = &ExplainPlan{CollScan: true, Indexes: []string{"user_1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+// fakeExplainer returns plans by collection and records the explain commands.
+type fakeExplainer struct {
+	mu    sync.Mutex
+	cmds  []bson.Raw
+	plans map[string]bson.D
+}
+
+func (f *fakeExplainer) explain(ctx context.Context, dbName string, cmd bson.Raw) (bson.Raw, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cmds = append(f.cmds, cmd)
+	coll, _ := cmd.Lookup("explain").Document().Values()
+	plan, ok := f.plans[coll[0].StringValue()]
+	if !ok {
+		return nil, errors.New("unknown collection")
+	}
+	return bson.Marshal(plan)
+}
+
+func (f *fakeExplainer) commands() []bson.Raw {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]bson.Raw(nil), f.cmds...)
+}
+
+func TestSlowQueryAnalyzer(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeExplainer{plans: map[string]bson.D{
+		"orders": {
+			{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{{Key: "stage", Value: "COLLSCAN"}}}}},
+			{Key: "executionStats", Value: bson.D{{Key: "nReturned", Value: 1}, {Key: "totalDocsExamined", Value: 5000}}},
+		},
+	}}
+	a := newSlowQueryAnalyzer(SlowQueryConfig{Threshold: 100 * time.Millisecond, ExplainInterval: time.Minute}, f.explain)
+	defer a.Close()
+	a.now = func() time.Time { return now }
+
+	c := &Client{}
+	var took time.Duration
+	c.Use(a.Intercept, func(ctx context.Context, op *OpInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		op.Duration = took
+		return err
+	})
+	ctx := context.Background()
+	query := func(name, coll string, filter interface{}, d time.Duration) {
+		took = d
+		c.do(ctx, &OpInfo{Name: name, Database: "app", Collection: coll, Filter: filter}, func(context.Context) error { return nil })
+	}
+
+	query("find", "orders", bson.D{{Key: "user", Value: "alice"}}, 300*time.Millisecond)
+	query("find", "orders", bson.D{{Key: "user", Value: "bob"}}, 200*time.Millisecond)
+	query("find", "orders", bson.D{{Key: "user", Value: "carol"}}, 50*time.Millisecond)
+	query("count", "users", bson.D{{Key: "age", Value: 30}}, 150*time.Millisecond)
+	query("deleteMany", "orders", bson.D{{Key: "user", Value: "alice"}}, time.Second)
+	explained := func() bool {
+		r := a.Report(0)
+		return len(r) == 2 && r[0].Plan != nil && r[0].Plan.ExplainedAt.Equal(now) && r[1].ExplainErr != nil
+	}
+	waitFor(t, explained)
+	if got := len(f.commands()); got != 2 {
+		t.Fatalf("got %d explains", got)
+	}
+
+	// the same shape is explained again after ExplainInterval
+	now = now.Add(time.Minute)
+	query("find", "orders", bson.D{{Key: "user", Value: "dave"}}, 100*time.Millisecond)
+	waitFor(t, explained)
+	if got := len(f.commands()); got != 3 {
+		t.Fatalf("got %d explains", got)
+	}
+
+	report := a.Report(0)
+	orders := report[0]
+	orders.Plan, report[1].ExplainErr = nil, nil
+	want := SlowQuery{Shape: `find app.orders {"filter":{"user":"?"}}`, Op: "find", Database: "app", Collection: "orders",
+		Count: 3, Total: 600 * time.Millisecond, Max: 300 * time.Millisecond, LastSeen: now}
+	if !reflect.DeepEqual(orders, want) {
+		t.Fatalf("got %+v", orders)
+	}
+	if plan := report[0].Plan; !plan.CollScan || plan.DocsExamined != 5000 || plan.Returned != 1 {
+		t.Fatalf("got plan %+v", plan)
+	}
+	if report[1].Shape != `count app.users {"filter":{"age":"?"}}` || report[1].Count != 1 {
+		t.Fatalf("got %+v", report[1])
+	}
+	if r := a.Report(1); len(r) != 1 || r[0].Shape != orders.Shape {
+		t.Fatalf("got %+v", r)
+	}
+
+	// explain runs the original query, only the report is redacted
+	var cmd struct {
+		Explain   bson.D `bson:"explain"`
+		Verbosity string `bson:"verbosity"`
+	}
+	if err := bson.Unmarshal(f.commands()[0], &cmd); err != nil {
+		t.Fatal(err)
+	}
+	wantCmd := bson.D{{Key: "find", Value: "orders"}, {Key: "filter", Value: bson.D{{Key: "user", Value: "alice"}}}}
+	if cmd.Verbosity != "executionStats" || !reflect.DeepEqual(cmd.Explain, wantCmd) {
+		t.Fatalf("got %+v", cmd)
+	}
+}
+
+func TestSlowQueryAnalyzerQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	a := newSlowQueryAnalyzer(SlowQueryConfig{Threshold: time.Nanosecond, QueueSize: 1, MaxShapes: 3},
+		func(ctx context.Context, dbName string, cmd bson.Raw) (bson.Raw, error) {
+			select {
+			case <-block:
+			case <-ctx.Done():
+			}
+			return nil, ctx.Err()
+		})
+	defer a.Close()
+	defer close(block)
+
+	for i, coll := range []string{"a", "b", "c", "d"} {
+		op := &OpInfo{Name: "find", Database: "app", Collection: coll, Duration: time.Second, Attempts: 1}
+		a.Intercept(context.Background(), op, func(context.Context) error { return nil })
+		if i == 0 {
+			// wait for the worker to take the first query so the second fills the queue
+			waitFor(t, func() bool { return len(a.queue) == 0 })
+		}
+	}
+	if got := a.Dropped(); got != 1 {
+		t.Fatalf("got %d dropped", got)
+	}
+	if got := len(a.Report(0)); got != 3 {
+		t.Fatalf("got %d shapes", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,93 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTransactionRetryTimeout 是 WithTransaction 重试事务的总时长上限，与驱动的 WithTransaction 一致。
+const DefaultTransactionRetryTimeout = 120 * time.Second
+
+const (
+	labelTransientTransaction     = "TransientTransactionError"
+	labelUnknownTransactionCommit = "UnknownTransactionCommitResult"
+)
+
+// WithTransaction 在一个会话的事务中执行 fn，fn 内的所有操作必须使用 txCtx，
+// 可以跨数据库和集合，要么全部提交要么全部回滚。
+// 带有 TransientTransactionError 标签的错误会重新执行整个事务，
+// 提交时带有 UnknownTransactionCommitResult 标签的错误会重新提交，
+// 重试的总时长不超过 DefaultTransactionRetryTimeout。
+// fn 返回错误或提交失败时事务总会被中止，会话总会被结束。
+// fn 返回的错误原样返回，开始或提交事务失败时返回 *Error。
+func (c *Client) WithTransaction(ctx context.Context, fn func(txCtx mongo.SessionContext) error,
+	opts ...*options.TransactionOptions) error {
+	session, err := c.RealCli.StartSession()
+	if err != nil {
+		return wrapError("startSession", "", "", err)
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+	txCtx := mongo.NewSessionContext(ctx, session)
+	return runTransaction(txCtx, session, func() error { return fn(txCtx) }, opts...)
+}
+
+// txSession 是 runTransaction 用到的 mongo.Session 的部分方法。
+type txSession interface {
+	StartTransaction(...*options.TransactionOptions) error
+	AbortTransaction(context.Context) error
+	CommitTransaction(context.Context) error
+}
+
+func runTransaction(ctx context.Context, session txSession, fn func() error, opts ...*options.TransactionOptions) error {
+	deadline := time.Now().Add(DefaultTransactionRetryTimeout)
+	abort := func() {
+		// 即使 ctx 已经取消也要中止事务
+		_ = session.AbortTransaction(context.WithoutCancel(ctx))
+	}
+	for {
+		if err := session.StartTransaction(opts...); err != nil {
+			return wrapError("startTransaction", "", "", err)
+		}
+		if err := fn(); err != nil {
+			abort()
+			if hasErrorLabel(err, labelTransientTransaction) && time.Now().Before(deadline) && ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+		err := commit(ctx, session, deadline)
+		if err == nil {
+			return nil
+		}
+		abort()
+		if hasErrorLabel(err, labelTransientTransaction) && time.Now().Before(deadline) && ctx.Err() == nil {
+			continue
+		}
+		return wrapError("commitTransaction", "", "", err)
+	}
+}
+
+// commit 提交事务，提交结果未知时重新提交。
+func commit(ctx context.Context, session txSession, deadline time.Time) error {
+	for {
+		err := session.CommitTransaction(ctx)
+		if err == nil || !hasErrorLabel(err, labelUnknownTransactionCommit) || isMaxTimeMSExpired(err) ||
+			!time.Now().Before(deadline) || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(label)
+}
+
+func isMaxTimeMSExpired(err error) bool {
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.IsMaxTimeMSExpiredError()
+}
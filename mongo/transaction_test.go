@@ -0,0 +1,84 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type fakeSession struct {
+	starts, aborts, commits int
+	commitErrs              []error
+}
+
+func (s *fakeSession) StartTransaction(...*options.TransactionOptions) error {
+	s.starts++
+	return nil
+}
+
+func (s *fakeSession) AbortTransaction(context.Context) error {
+	s.aborts++
+	return nil
+}
+
+func (s *fakeSession) CommitTransaction(context.Context) error {
+	s.commits++
+	if len(s.commitErrs) == 0 {
+		return nil
+	}
+	err := s.commitErrs[0]
+	s.commitErrs = s.commitErrs[1:]
+	return err
+}
+
+func TestRunTransaction(t *testing.T) {
+	transient := mongo.CommandError{Message: "conflict", Labels: []string{labelTransientTransaction}}
+	unknown := mongo.CommandError{Message: "timeout", Labels: []string{labelUnknownTransactionCommit}}
+	errFailed := errors.New("failed")
+	cases := []struct {
+		name       string
+		fnErrs     []error
+		commitErrs []error
+		want       error
+		starts     int
+		aborts     int
+		commits    int
+	}{
+		{name: "commit", starts: 1, commits: 1},
+		{name: "fn error", fnErrs: []error{errFailed}, want: errFailed, starts: 1, aborts: 1},
+		{name: "transient fn error", fnErrs: []error{transient, transient}, starts: 3, aborts: 2, commits: 1},
+		{name: "unknown commit result", commitErrs: []error{unknown, unknown}, starts: 1, commits: 3},
+		{name: "transient commit error", commitErrs: []error{transient}, starts: 2, aborts: 1, commits: 2},
+		{name: "commit error", commitErrs: []error{errFailed}, want: errFailed, starts: 1, aborts: 1, commits: 1},
+	}
+	for _, c := range cases {
+		s := &fakeSession{commitErrs: c.commitErrs}
+		fnErrs := c.fnErrs
+		err := runTransaction(context.Background(), s, func() error {
+			if len(fnErrs) == 0 {
+				return nil
+			}
+			err := fnErrs[0]
+			fnErrs = fnErrs[1:]
+			return err
+		})
+		if !errors.Is(err, c.want) || s.starts != c.starts || s.aborts != c.aborts || s.commits != c.commits {
+			t.Errorf("%s: got %v, %d starts, %d aborts, %d commits", c.name, err, s.starts, s.aborts, s.commits)
+		}
+	}
+}
+
+func TestRunTransactionCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &fakeSession{}
+	err := runTransaction(ctx, s, func() error {
+		cancel()
+		return mongo.CommandError{Labels: []string{labelTransientTransaction}}
+	})
+	if err == nil || s.starts != 1 || s.aborts != 1 {
+		t.Fatalf("got %v, %d starts, %d aborts", err, s.starts, s.aborts)
+	}
+}
@@ -55,6 +55,9 @@ func (m *Manager) delNsqInstance(category string) {
 }
 
 func (m *Manager) getProducerManager(category string) (*ProducerManager, error) {
+	if m == nil {
+		return nil, errors.New("nsq manager not initialized")
+	}
 	pmObj, ok := m.producerManagers.Load(category)
 	if !ok {
 		return nil, fmt.Errorf("type  err")
@@ -251,6 +254,34 @@ func (ins *ProducerManager) deleteChannlInEveryNsqdNode(topic, channel, nodeAddr
 	resp.Body.Close()
 }
 
+// Publish publishes data and returns once nsqd acknowledged it.
+func Publish(insType string, topic string, data []byte) error {
+	nsqIns, err := nsqMgr.getProducerManager(insType)
+	if err != nil {
+		return err
+	}
+	producer := nsqIns.GetProducer()
+	if producer == nil {
+		return errors.New("producer do not exist ")
+	}
+	return producer.p.Publish(topic, data)
+}
+
+// Publisher publishes a message and returns once nsqd acknowledged it.
+type Publisher interface {
+	Publish(topic string, data []byte) error
+}
+
+// CategoryPublisher publishes synchronously through the producers of a
+// category.
+type CategoryPublisher struct {
+	Category string
+}
+
+func (p *CategoryPublisher) Publish(topic string, data []byte) error {
+	return Publish(p.Category, topic, data)
+}
+
 func PublishAsync(insType string, topic string, data []byte, doneChan chan *nsq.ProducerTransaction) error {
 	nsqIns, err := nsqMgr.getProducerManager(insType)
 	if err != nil {
@@ -1,9 +1,102 @@
 package alphaBroker
 
+import "context"
+
 type CallBack func()
 
+// Handler is the context-aware callback of an Operation, its result is
+// delivered back through the Future returned by NewOperation.
+type Handler func(ctx context.Context) (interface{}, error)
+
 type Operation struct {
 	IsAsynchronous bool
 	Cb             CallBack
 	Ret            chan interface{}
+
+	Priority Priority
+	// Key orders asynchronous operations, the ones sharing a Key run serially.
+	Key string
+
+	// Ctx is passed to Handler, an Operation whose Ctx is done before it
+	// runs is completed with Ctx.Err() without being executed.
+	Ctx     context.Context
+	Handler Handler
+
+	done func(interface{}, error)
+}
+
+// NewOperation builds an Operation running fn and the Future receiving its result.
+func NewOperation[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) (Operation, *Future[T]) {
+	ctx, cancel := context.WithCancel(ctx)
+	f := newFuture[T](ctx, cancel)
+	op := Operation{
+		Ctx: ctx,
+		Handler: func(ctx context.Context) (interface{}, error) {
+			return fn(ctx)
+		},
+		done: func(v interface{}, err error) {
+			t, _ := v.(T)
+			f.complete(t, err)
+		},
+	}
+	return op, f
+}
+
+// Submit resolves fn on c and returns the Future of its result.
+func Submit[T any](ctx context.Context, c Component, fn func(ctx context.Context) (T, error)) *Future[T] {
+	op, f := NewOperation(ctx, fn)
+	c.Resolve(op)
+	return f
+}
+
+func (op *Operation) context() context.Context {
+	if op.Ctx == nil {
+		return context.Background()
+	}
+	return op.Ctx
+}
+
+// run adapts the legacy Cb and the Handler to a single call shape.
+func (op *Operation) run() (interface{}, error) {
+	ctx := op.context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if op.Handler != nil {
+		return op.Handler(ctx)
+	}
+	if op.Cb != nil {
+		op.Cb()
+	}
+	return nil, nil
+}
+
+// finish reports the result to the Future and to Ret, Ret keeps receiving
+// struct{}{} on success and receives the error otherwise.
+func (op *Operation) finish(v interface{}, err error) {
+	if op.done != nil {
+		op.done(v, err)
+	}
+	if op.Ret != nil {
+		if err != nil {
+			op.Ret <- err
+		} else {
+			op.Ret <- struct{}{}
+		}
+	}
+}
+
+// fail completes an operation rejected before it ran. Resolve rejects in
+// the caller's goroutine, which may be the one meant to read Ret, and Stop
+// and the drain must not wait for callers, so Ret is sent from a new
+// goroutine instead.
+func (op *Operation) fail(err error) {
+	if op.done != nil {
+		op.done(nil, err)
+	}
+	if op.Ret != nil {
+		go func(ret chan interface{}) {
+			ret <- err
+		}(op.Ret)
+	}
 }
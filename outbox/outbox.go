@@ -0,0 +1,165 @@
+// Package outbox publishes NSQ messages written to MongoDB in the same
+// transaction as the business documents, so that a message is sent if and
+// only if the write it describes was committed.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlphaMinZ/alpha_broker/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultCollection = "outbox"
+
+var ErrNoTransaction = errors.New("outbox: enqueue outside a transaction")
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+	// StatusDead is a message given up after RelayConfig.MaxAttempts.
+	StatusDead Status = "dead"
+)
+
+// Message is an outbox entry. The messages sharing a Key are published in
+// the order they were enqueued, a message without Key is not ordered.
+type Message struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Topic string             `bson:"topic"`
+	Key   string             `bson:"key,omitempty"`
+	Body  []byte             `bson:"body"`
+
+	Status      Status    `bson:"status"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	Attempts    int       `bson:"attempts"`
+	NextAttempt time.Time `bson:"nextAttempt"`
+	LastError   string    `bson:"lastError,omitempty"`
+	SentAt      time.Time `bson:"sentAt,omitempty"`
+}
+
+func NewMessage(topic, key string, body []byte) *Message {
+	return &Message{Topic: topic, Key: key, Body: body}
+}
+
+// Outbox is the collection holding the messages.
+type Outbox struct {
+	Client   *mongo.Client
+	DBName   string
+	CollName string
+}
+
+func New(client *mongo.Client, dbName string) *Outbox {
+	return &Outbox{Client: client, DBName: dbName, CollName: DefaultCollection}
+}
+
+// Enqueue inserts the messages in the transaction of txCtx, the context
+// given to the function of mongo.Client.WithTransaction:
+//
+//	err := client.WithTransaction(ctx, func(txCtx driver.SessionContext) error {
+//		if _, err := client.UpdateOne(txCtx, "shop", "orders", filter, update); err != nil {
+//			return err
+//		}
+//		return box.Enqueue(txCtx, outbox.NewMessage("orders", orderID, body))
+//	})
+func (o *Outbox) Enqueue(txCtx context.Context, msgs ...*Message) error {
+	if driver.SessionFromContext(txCtx) == nil {
+		return ErrNoTransaction
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.ID.IsZero() {
+			msg.ID = primitive.NewObjectIDFromTimestamp(now)
+		}
+		msg.Status, msg.CreatedAt, msg.NextAttempt = StatusPending, now, now
+		docs = append(docs, msg)
+	}
+	_, err := o.Client.InsertMany(txCtx, o.DBName, o.CollName, docs)
+	return err
+}
+
+// EnsureIndexes creates the index the relay polls with, and when retention
+// is positive a TTL index removing the sent messages after it.
+func (o *Outbox) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := o.Client.CreateIndex(ctx, o.DBName, o.CollName, driver.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil || retention <= 0 {
+		return err
+	}
+	_, err = o.Client.CreateIndex(ctx, o.DBName, o.CollName, driver.IndexModel{
+		Keys:    bson.D{{Key: "sentAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(retention / time.Second)),
+	})
+	return err
+}
+
+// Dead returns the messages given up by the relay, oldest first.
+func (o *Outbox) Dead(ctx context.Context, limit int) ([]*Message, error) {
+	return o.find(ctx, StatusDead, limit)
+}
+
+// Requeue makes a dead message pending again, the messages enqueued after
+// it with the same Key wait for it again.
+func (o *Outbox) Requeue(ctx context.Context, id primitive.ObjectID) error {
+	_, err := o.Client.UpdateOne(ctx, o.DBName, o.CollName,
+		bson.M{"_id": id, "status": StatusDead},
+		bson.M{"$set": bson.M{"status": StatusPending, "attempts": 0, "nextAttempt": time.Now()}})
+	return err
+}
+
+// pending returns the messages due at now, leaving out the keys with a
+// message waiting for its next attempt so that they do not fill the batch.
+func (o *Outbox) pending(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	held, err := o.Client.Distinct(ctx, o.DBName, o.CollName, "key",
+		bson.M{"status": StatusPending, "nextAttempt": bson.M{"$gt": now}})
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"status": StatusPending, "nextAttempt": bson.M{"$lte": now}}
+	if len(held) > 0 {
+		filter["key"] = bson.M{"$nin": held}
+	}
+	return o.findWithFilter(ctx, filter, limit)
+}
+
+func (o *Outbox) find(ctx context.Context, status Status, limit int) ([]*Message, error) {
+	return o.findWithFilter(ctx, bson.M{"status": status}, limit)
+}
+
+func (o *Outbox) findWithFilter(ctx context.Context, filter bson.M, limit int) ([]*Message, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cur, err := o.Client.FindWithOption(ctx, o.DBName, o.CollName, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*Message
+	if err := cur.All(ctx, &msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (o *Outbox) update(ctx context.Context, msg *Message) error {
+	set := bson.M{
+		"status":      msg.Status,
+		"attempts":    msg.Attempts,
+		"nextAttempt": msg.NextAttempt,
+		"lastError":   msg.LastError,
+	}
+	if !msg.SentAt.IsZero() {
+		set["sentAt"] = msg.SentAt
+	}
+	_, err := o.Client.UpdateOne(ctx, o.DBName, o.CollName,
+		bson.M{"_id": msg.ID, "status": StatusPending}, bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+	"github.com/AlphaMinZ/alpha_broker/nsq"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+	DefaultMaxAttempts  = 10
+	DefaultBackoff      = time.Second
+	DefaultMaxBackoff   = time.Minute
+)
+
+// store is the part of Outbox the relay uses.
+type store interface {
+	pending(ctx context.Context, now time.Time, limit int) ([]*Message, error)
+	update(ctx context.Context, msg *Message) error
+}
+
+type RelayConfig struct {
+	// Category is the nsq.Manager category publishing the messages, unless
+	// Publisher is set.
+	Category  string
+	Publisher nsq.Publisher
+
+	// PollInterval is the delay between two polls of the outbox, a full
+	// batch is followed by the next one right away.
+	PollInterval time.Duration
+	BatchSize    int
+
+	// MaxAttempts is how many times a message is published before it is
+	// marked dead, the next message with the same Key is published then.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled for each
+	// attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (c *RelayConfig) defaults() {
+	if c.Publisher == nil {
+		c.Publisher = &nsq.CategoryPublisher{Category: c.Category}
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+}
+
+// Relay publishes the pending messages of an outbox and marks them sent
+// once the publish is acknowledged, a message is published at least once.
+// A single relay should run per outbox, two relays would publish the same
+// messages twice.
+type Relay struct {
+	*alphaBroker.Runner
+	conf  RelayConfig
+	store store
+	now   func() time.Time
+}
+
+func NewRelay(outbox *Outbox, conf RelayConfig) *Relay {
+	conf.defaults()
+	r := &Relay{
+		conf:  conf,
+		store: outbox,
+		now:   time.Now,
+	}
+	r.Runner = alphaBroker.NewRunner("outbox relay", r.run)
+	return r
+}
+
+// run polls until ctx ends, the relay has started once the first poll is
+// over: an outbox that cannot be read fails Start. Stopping waits for the
+// message being published to be dealt with.
+func (r *Relay) run(ctx context.Context, started func(error)) error {
+	for {
+		n, err := r.relay(ctx)
+		started(err)
+		if err != nil {
+			log.Printf("outbox relay: %v", err)
+		}
+		if err == nil && n == r.conf.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.conf.PollInterval):
+		}
+	}
+}
+
+// relay publishes a batch of due messages in order. A message waiting for
+// its next attempt holds back the later messages with the same Key, the
+// store leaves them out of the batch. It returns how many messages were
+// attempted.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	msgs, err := r.store.pending(ctx, r.now(), r.conf.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	held := make(map[string]bool)
+	attempted := 0
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return attempted, ctx.Err()
+		}
+		if msg.Key != "" && held[msg.Key] {
+			continue
+		}
+		now := r.now()
+		attempted++
+		if err := r.conf.Publisher.Publish(msg.Topic, msg.Body); err != nil {
+			msg.Attempts++
+			msg.LastError = err.Error()
+			if msg.Attempts >= r.conf.MaxAttempts {
+				msg.Status = StatusDead
+				log.Printf("outbox relay: message %s to %q is dead after %d attempts: %v",
+					msg.ID.Hex(), msg.Topic, msg.Attempts, err)
+			} else {
+				msg.NextAttempt = now.Add(r.backoff(msg.Attempts))
+				held[msg.Key] = true
+			}
+		} else {
+			msg.Status, msg.SentAt, msg.LastError = StatusSent, now, ""
+		}
+		// the later messages of the key must not pass a message whose
+		// state is unknown, the batch ends here
+		if err := r.store.update(ctx, msg); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	return alphaBroker.Backoff(r.conf.Backoff, r.conf.MaxBackoff, attempts)
+}
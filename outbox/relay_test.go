@@ -0,0 +1,225 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeStore struct {
+	msgs       []*Message
+	pendingErr error
+	updateErr  error
+}
+
+func (s *fakeStore) add(topic, key string, at time.Time) *Message {
+	msg := NewMessage(topic, key, []byte(topic))
+	msg.ID = primitive.NewObjectID()
+	msg.Status, msg.CreatedAt, msg.NextAttempt = StatusPending, at, at
+	s.msgs = append(s.msgs, msg)
+	return msg
+}
+
+func (s *fakeStore) pending(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	if s.pendingErr != nil {
+		return nil, s.pendingErr
+	}
+	held := make(map[string]bool)
+	for _, msg := range s.msgs {
+		if msg.Status == StatusPending && msg.Key != "" && msg.NextAttempt.After(now) {
+			held[msg.Key] = true
+		}
+	}
+	var msgs []*Message
+	for _, msg := range s.msgs {
+		if msg.Status == StatusPending && !msg.NextAttempt.After(now) && !held[msg.Key] && len(msgs) < limit {
+			copied := *msg
+			msgs = append(msgs, &copied)
+		}
+	}
+	return msgs, nil
+}
+
+func (s *fakeStore) update(ctx context.Context, msg *Message) error {
+	if s.updateErr != nil {
+		return s.updateErr
+	}
+	for i, m := range s.msgs {
+		if m.ID == msg.ID {
+			copied := *msg
+			s.msgs[i] = &copied
+		}
+	}
+	return nil
+}
+
+type fakePublisher struct {
+	sent []string
+	fail map[string]int // failures left by topic
+}
+
+func (p *fakePublisher) Publish(topic string, body []byte) error {
+	if p.fail[topic] > 0 {
+		p.fail[topic]--
+		return errors.New("nsqd unavailable")
+	}
+	p.sent = append(p.sent, topic)
+	return nil
+}
+
+func newTestRelay(conf RelayConfig, s *fakeStore, now *time.Time) *Relay {
+	r := NewRelay(nil, conf)
+	r.store = s
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+func TestRelayOrdering(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeStore{}
+	s.add("a1", "a", now)
+	s.add("b1", "b", now)
+	s.add("a2", "a", now)
+	s.add("x", "", now)
+	pub := &fakePublisher{fail: map[string]int{"a1": 1}}
+	r := newTestRelay(RelayConfig{Publisher: pub, Backoff: time.Second}, s, &now)
+
+	// a1 fails and holds a2 back, the other keys go on
+	if n, err := r.relay(context.Background()); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"b1", "x"}) {
+		t.Fatal(pub.sent)
+	}
+	if a1 := s.msgs[0]; a1.Attempts != 1 || a1.LastError == "" || !a1.NextAttempt.Equal(now.Add(time.Second)) {
+		t.Fatalf("got %+v", a1)
+	}
+
+	// a1 is not retried before its backoff
+	if n, _ := r.relay(context.Background()); n != 0 {
+		t.Fatal(n)
+	}
+	now = now.Add(time.Second)
+	if _, err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"b1", "x", "a1", "a2"}) {
+		t.Fatal(pub.sent)
+	}
+	for _, msg := range s.msgs {
+		if msg.Status != StatusSent || msg.SentAt.IsZero() {
+			t.Fatalf("got %+v", msg)
+		}
+	}
+}
+
+func TestRelayHeldKeyBatch(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeStore{}
+	s.add("a1", "a", now)
+	s.add("a2", "a", now)
+	s.add("a3", "a", now)
+	s.add("b1", "b", now)
+	pub := &fakePublisher{fail: map[string]int{"a1": 1}}
+	r := newTestRelay(RelayConfig{Publisher: pub, BatchSize: 2, Backoff: time.Second}, s, &now)
+
+	if _, err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the messages of a waiting for a1 do not fill the batch before b1
+	if n, err := r.relay(context.Background()); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"b1"}) {
+		t.Fatal(pub.sent)
+	}
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeStore{}
+	s.add("a1", "a", now)
+	s.add("a2", "a", now)
+	pub := &fakePublisher{fail: map[string]int{"a1": 3}}
+	r := newTestRelay(RelayConfig{Publisher: pub, MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second}, s, &now)
+
+	var backoffs []time.Duration
+	for i := 0; i < 3; i++ {
+		if _, err := r.relay(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		backoffs = append(backoffs, s.msgs[0].NextAttempt.Sub(now))
+		now = now.Add(time.Minute)
+	}
+	if !reflect.DeepEqual(backoffs[:2], []time.Duration{time.Second, 2 * time.Second}) {
+		t.Fatal(backoffs)
+	}
+	if r.backoff(5) != 3*time.Second {
+		t.Fatal(r.backoff(5))
+	}
+	// a1 is dead and a2 went out in the same batch
+	if a1 := s.msgs[0]; a1.Status != StatusDead || a1.Attempts != 3 {
+		t.Fatalf("got %+v", a1)
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"a2"}) || s.msgs[1].Status != StatusSent {
+		t.Fatal(pub.sent)
+	}
+}
+
+func TestRelayUpdateError(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeStore{updateErr: errors.New("not primary")}
+	s.add("a1", "a", now)
+	s.add("a2", "a", now)
+	pub := &fakePublisher{}
+	r := newTestRelay(RelayConfig{Publisher: pub}, s, &now)
+
+	// a1 may be published again, a2 must not pass it
+	if _, err := r.relay(context.Background()); err == nil {
+		t.Fatal("update error not reported")
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"a1"}) || s.msgs[0].Status != StatusPending {
+		t.Fatal(pub.sent)
+	}
+	s.updateErr = nil
+	if _, err := r.relay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pub.sent, []string{"a1", "a1", "a2"}) {
+		t.Fatal(pub.sent)
+	}
+}
+
+func TestRelayStart(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &fakeStore{}
+	s.add("a1", "a", now)
+	pub := &fakePublisher{}
+	r := newTestRelay(RelayConfig{Publisher: pub, PollInterval: time.Hour}, s, &now)
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the first poll is over once Start returns
+	if !reflect.DeepEqual(pub.sent, []string{"a1"}) {
+		t.Fatal(pub.sent)
+	}
+	if err := r.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.pendingErr = errors.New("not authorized on app")
+	r = newTestRelay(RelayConfig{Publisher: pub}, s, &now)
+	if err := r.Start(context.Background()); !errors.Is(err, s.pendingErr) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestEnqueueOutsideTransaction(t *testing.T) {
+	if err := New(nil, "app").Enqueue(context.Background(), NewMessage("orders", "1", nil)); !errors.Is(err, ErrNoTransaction) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package alphaBroker
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrPoolFull = errors.New("worker pool queue full")
+
+type PoolConfig struct {
+	MaxWorkers int
+	// QueueSize is the capacity of the shared queue and of each worker queue.
+	QueueSize int
+}
+
+func (c *PoolConfig) defaults() {
+	if c.MaxWorkers <= 0 {
+		c.MaxWorkers = DefaultPoolWorkers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultPoolQueueSize
+	}
+}
+
+type PoolStats struct {
+	Workers   int
+	Busy      int
+	Queued    int
+	Completed uint64
+	Rejected  uint64
+}
+
+// workerPool runs the asynchronous operations. Operations without a key go
+// to the shared queue, operations with a key always go to the same worker
+// so that they run serially.
+type workerPool struct {
+	conf   PoolConfig
+	shared chan func()
+	keyed  []chan func()
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+
+	busy      atomic.Int64
+	completed atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+func newWorkerPool(conf PoolConfig) *workerPool {
+	p := &workerPool{
+		conf:   conf,
+		shared: make(chan func(), conf.QueueSize),
+		keyed:  make([]chan func(), conf.MaxWorkers),
+	}
+	for i := range p.keyed {
+		p.keyed[i] = make(chan func(), conf.QueueSize)
+	}
+	return p
+}
+
+func (p *workerPool) start() {
+	p.startOnce.Do(func() {
+		for _, own := range p.keyed {
+			p.wg.Add(1)
+			go p.work(own)
+		}
+	})
+}
+
+func (p *workerPool) work(own chan func()) {
+	defer p.wg.Done()
+	shared := p.shared
+	for own != nil || shared != nil {
+		var (
+			fn func()
+			ok bool
+		)
+		select {
+		case fn, ok = <-own:
+			if !ok {
+				own = nil
+				continue
+			}
+		case fn, ok = <-shared:
+			if !ok {
+				shared = nil
+				continue
+			}
+		}
+		p.busy.Add(1)
+		fn()
+		p.busy.Add(-1)
+		p.completed.Add(1)
+	}
+}
+
+// submit queues fn without blocking the component loop.
+func (p *workerPool) submit(key string, fn func()) error {
+	queue := p.shared
+	if key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		queue = p.keyed[h.Sum32()%uint32(len(p.keyed))]
+	}
+	select {
+	case queue <- fn:
+		return nil
+	default:
+		p.rejected.Add(1)
+		return ErrPoolFull
+	}
+}
+
+// stop waits for the queued operations to run, submit must not be called afterwards.
+func (p *workerPool) stop() {
+	p.stopOnce.Do(func() {
+		close(p.shared)
+		for _, own := range p.keyed {
+			close(own)
+		}
+		p.wg.Wait()
+	})
+}
+
+func (p *workerPool) stats() PoolStats {
+	queued := len(p.shared)
+	for _, own := range p.keyed {
+		queued += len(own)
+	}
+	return PoolStats{
+		Workers:   len(p.keyed),
+		Busy:      int(p.busy.Load()),
+		Queued:    queued,
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+	}
+}
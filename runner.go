@@ -0,0 +1,129 @@
+package alphaBroker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var ErrNoMailbox = errors.New("component has no mailbox")
+
+// RunFunc is the work of a Runner. It calls started once it is ready, with
+// the error that fails the start if any, and returns when ctx ends or it
+// cannot go on.
+type RunFunc func(ctx context.Context, started func(err error)) error
+
+// Runner is a Component running a RunFunc on its own goroutine instead of
+// resolving operations, like a poller or a watcher.
+type Runner struct {
+	name string
+	run  RunFunc
+
+	mu     sync.Mutex
+	state  State
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// NewRunner returns a runner of fn, name prefixes what it logs.
+func NewRunner(name string, fn RunFunc) *Runner {
+	return &Runner{name: name, run: fn}
+}
+
+func (r *Runner) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// Resolve fails every operation, a runner has no mailbox.
+func (r *Runner) Resolve(op Operation) {
+	op.fail(ErrNoMailbox)
+}
+
+func (r *Runner) Launch() {
+	r.Start(context.Background())
+}
+
+// Start runs the function and returns once it called started. The error
+// given to started, or the end of ctx before it, stops the run and is
+// returned. Starting a running runner does nothing.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	switch r.state {
+	case StateRunning:
+		r.mu.Unlock()
+		return nil
+	case StateStopped:
+		r.mu.Unlock()
+		return ErrComponentStopped
+	}
+	r.state = StateRunning
+	runCtx, cancel := context.WithCancel(context.Background())
+	r.cancel, r.done = cancel, make(chan struct{})
+	done := r.done
+	r.mu.Unlock()
+
+	startCh := make(chan error, 1)
+	var once sync.Once
+	started := func(err error) {
+		once.Do(func() { startCh <- err })
+	}
+	go r.loop(runCtx, done, started)
+
+	var err error
+	select {
+	case err = <-startCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		<-done
+	}
+	return err
+}
+
+func (r *Runner) loop(ctx context.Context, done chan struct{}, started func(error)) {
+	defer close(done)
+	err := r.run(ctx, started)
+	// a run ending before it started fails the start
+	started(err)
+	if ctx.Err() != nil {
+		err = nil
+	} else if err != nil {
+		log.Printf("%s stopped: %v", r.name, err)
+	}
+	r.mu.Lock()
+	r.state, r.err = StateStopped, err
+	r.mu.Unlock()
+}
+
+// Stop cancels the run and waits for it to return or ctx to end.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if r.state == StateCreated {
+		r.state = StateStopped
+	}
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Err returns why the run ended on its own, nil while it runs or after Stop.
+func (r *Runner) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
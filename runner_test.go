@@ -0,0 +1,61 @@
+package alphaBroker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunner(t *testing.T) {
+	stopped := make(chan struct{})
+	r := NewRunner("poller", func(ctx context.Context, started func(error)) error {
+		started(nil)
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+	if err := r.Start(context.Background()); err != nil || r.State() != StateRunning {
+		t.Fatalf("got %v in state %v", err, r.State())
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ret := make(chan interface{})
+	if v := recvRet(t, func() { r.Resolve(Operation{Ret: ret}) }, ret); v != ErrNoMailbox {
+		t.Fatalf("got %v", v)
+	}
+	if err := r.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-stopped
+	if r.State() != StateStopped || r.Err() != nil {
+		t.Fatalf("got %v in state %v", r.Err(), r.State())
+	}
+}
+
+func TestRunnerStartError(t *testing.T) {
+	errUnreachable := errors.New("unreachable")
+	runs := 0
+	r := NewRunner("watcher", func(ctx context.Context, started func(error)) error {
+		runs++
+		started(errUnreachable)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	app := NewApplication(ApplicationConfig{})
+	app.Register("watcher", r)
+	if err := app.Start(context.Background()); !errors.Is(err, errUnreachable) || !errors.Is(err, ErrLaunchFailed) {
+		t.Fatalf("got %v", err)
+	}
+	if r.State() != StateStopped || runs != 1 {
+		t.Fatalf("state %v after %d runs", r.State(), runs)
+	}
+
+	// a run returning before it started fails the start with its error
+	r = NewRunner("watcher", func(ctx context.Context, started func(error)) error {
+		return errUnreachable
+	})
+	if err := r.Start(context.Background()); !errors.Is(err, errUnreachable) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package alphaBroker
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError is reported to the caller when an operation panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("operation panic: %v\n%s", e.Value, e.Stack)
+}
+
+func newPanicError(v interface{}) *PanicError {
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+type RestartStrategy int
+
+const (
+	// RestartNone keeps the loop running after a recovered panic.
+	RestartNone RestartStrategy = iota
+	// RestartOneForOne restarts the loop of the panicking component only.
+	RestartOneForOne
+)
+
+// SupervisorPolicy decides what happens to the loop of a component after
+// a synchronous operation panicked.
+type SupervisorPolicy struct {
+	Strategy RestartStrategy
+	// MaxRestarts within Window, the component stops once it is exceeded.
+	MaxRestarts int
+	Window      time.Duration
+	// Backoff before a restart, doubled for every restart within Window.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	OnPanic    func(*PanicError)
+	OnRestart  func(restarts int)
+}
+
+func (p *SupervisorPolicy) defaults() {
+	if p.MaxRestarts == 0 {
+		p.MaxRestarts = DefaultMaxRestarts
+	}
+	if p.Window == 0 {
+		p.Window = DefaultRestartWindow
+	}
+	if p.Backoff == 0 {
+		p.Backoff = DefaultRestartBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultRestartMaxBackoff
+	}
+}
+
+func (p *SupervisorPolicy) report(perr *PanicError) {
+	if p.OnPanic != nil {
+		p.OnPanic(perr)
+		return
+	}
+	log.Println(perr)
+}
+
+type supervisor struct {
+	policy   *SupervisorPolicy
+	restarts []time.Time
+}
+
+// next returns the backoff before the next restart, false once the
+// restart budget of the window is spent.
+func (s *supervisor) next(now time.Time) (time.Duration, bool) {
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.policy.Window {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+	if len(s.restarts) >= s.policy.MaxRestarts {
+		return 0, false
+	}
+	backoff := Backoff(s.policy.Backoff, s.policy.MaxBackoff, len(s.restarts)+1)
+	s.restarts = append(s.restarts, now)
+	return backoff, true
+}
+
+// Backoff returns the exponential backoff before the attempt after n
+// failures: base doubled for each failure after the first, up to max.
+func Backoff(base, max time.Duration, n int) time.Duration {
+	backoff := base
+	for i := 1; i < n && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,474 @@
+package timerassistant
+
+import (
+	"container/list"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type timer struct {
+	id     TimerID
+	info   *CallInfo
+	paused bool
+	// backlog is the count of missed calls still to replay
+	backlog int
+	// running counts the calls handed to the owner and not over yet
+	running int
+	runs    int
+	// retry numbers the retry the timer is scheduled for, 0 for a call
+	retry int
+	// done is set once MaxRuns calls were made
+	done  bool
+	stats timerStats
+
+	// next call time, and position in the timing wheel
+	at     time.Time
+	expire uint64
+	level  int
+	slot   *list.List
+	elem   *list.Element
+}
+
+// timerIndex finds the due timers, it is only used under the assistant lock.
+type timerIndex interface {
+	// schedule places the timer at t.at, a zero time is never due.
+	schedule(t *timer)
+	unschedule(t *timer)
+	collect(now time.Time) []*timer
+}
+
+// assistant holds what the TimerAssistant implementations share, they only
+// differ by the index finding the due timers.
+type assistant struct {
+	tickTime time.Duration
+	index    timerIndex
+	clock    Clock
+
+	mu     sync.Mutex
+	owner  Owner
+	store  TimerStore
+	leases *leaser
+	nextID TimerID
+	timers map[TimerID]*timer
+	// stop ends the goroutines of Loop, nil when it does not run
+	stop chan struct{}
+	loop sync.WaitGroup
+}
+
+func newAssistant(tickTime time.Duration, index timerIndex, clock Clock) *assistant {
+	return &assistant{
+		tickTime: tickTime,
+		index:    index,
+		clock:    clock,
+		owner:    inlineOwner,
+		timers:   make(map[TimerID]*timer),
+	}
+}
+
+// AssertOwner binds the owner executing the fired callbacks.
+func (a *assistant) AssertOwner(owner Owner) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owner = owner
+}
+
+// SetStore sets the store keeping the named timers, it is set before the
+// timers are added.
+func (a *assistant) SetStore(store TimerStore) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store = store
+}
+
+// SetLeases enables the singleton timers, it is set before Loop.
+func (a *assistant) SetLeases(conf LeaseConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.leases = newLeaser(conf)
+}
+
+// RenewLeases acquires or renews the leases of the singleton timers, Loop
+// calls it every RenewInterval.
+func (a *assistant) RenewLeases() {
+	a.mu.Lock()
+	leases := a.leases
+	var names []string
+	for _, t := range a.timers {
+		if t.info.Singleton && t.info.Name != "" {
+			names = append(names, t.info.Name)
+		}
+	}
+	a.mu.Unlock()
+	if leases != nil {
+		leases.renew(names, a.clock.Now())
+	}
+}
+
+// Lease returns the lease held on the singleton timer name, its token
+// fences the writes of the job.
+func (a *assistant) Lease(name string) (Lease, bool) {
+	a.mu.Lock()
+	leases := a.leases
+	a.mu.Unlock()
+	if leases == nil {
+		return Lease{}, false
+	}
+	return leases.holds(name, a.clock.Now())
+}
+
+// AddCallBack adds the timer, a named one is restored from the store when
+// it was registered before. The store is read and written outside of the
+// lock, a slow store does not hold the ticks back.
+func (a *assistant) AddCallBack(info *CallInfo) TimerID {
+	a.mu.Lock()
+	store := a.store
+	a.mu.Unlock()
+	var (
+		record        TimerRecord
+		loaded, found bool
+	)
+	if info.Name != "" && store != nil {
+		r, ok, err := store.Load(info.Name)
+		if err != nil {
+			log.Println("timerassistant: load", info.Name, err)
+		} else {
+			record, loaded, found = r, true, ok
+		}
+	}
+
+	a.mu.Lock()
+	a.nextID++
+	t := &timer{id: a.nextID, info: info}
+	a.timers[t.id] = t
+	a.setClock(info.Category)
+	now := a.clock.Now()
+	if found {
+		a.restore(t, record, now)
+	}
+	a.schedule(t, now)
+	a.mu.Unlock()
+
+	if loaded && !found {
+		if err := store.Save(TimerRecord{Name: info.Name}); err != nil {
+			log.Println("timerassistant: save", info.Name, err)
+		}
+	}
+	return t.id
+}
+
+// schedule places the timer at its next call, delayed by the jitter.
+func (a *assistant) schedule(t *timer, now time.Time) {
+	a.index.unschedule(t)
+	t.retry = 0
+	if t.done {
+		t.at = time.Time{}
+		return
+	}
+	t.at = t.info.Category.Next(now)
+	if !t.at.IsZero() {
+		t.at = t.at.Add(t.info.Policy.jitter())
+	}
+	a.index.schedule(t)
+}
+
+// restore resumes the timer from the last call of its record and applies
+// its misfire policy to the calls missed since.
+func (a *assistant) restore(t *timer, r TimerRecord, now time.Time) {
+	if r.LastCallTime == 0 {
+		return
+	}
+	category := t.info.Category
+	category.SetLastCallTime(r.LastCallTime)
+	switch t.info.Misfire {
+	case MisfireSkip:
+		if at := category.Next(now); !at.IsZero() && !at.After(now) {
+			category.SetLastCallTime(now.UnixNano())
+			t.stats.misses++
+		}
+	case MisfireFireAll:
+		missed, last := 0, r.LastCallTime
+		for missed < misfireLimit {
+			at := category.Next(now)
+			if at.IsZero() || at.After(now) || at.UnixNano() <= last {
+				break
+			}
+			missed++
+			last = at.UnixNano()
+			category.SetLastCallTime(last)
+		}
+		category.SetLastCallTime(r.LastCallTime)
+		if missed > 1 {
+			t.backlog = missed - 1
+		}
+	}
+}
+
+func (a *assistant) DelCallBack(id TimerID) {
+	a.mu.Lock()
+	t, ok := a.timers[id]
+	if ok {
+		a.index.unschedule(t)
+		delete(a.timers, id)
+	}
+	store, leases := a.store, a.leases
+	a.mu.Unlock()
+	if !ok || t.info.Name == "" {
+		return
+	}
+	if store != nil {
+		if err := store.Delete(t.info.Name); err != nil {
+			log.Println("timerassistant: delete", t.info.Name, err)
+		}
+	}
+	if leases != nil && t.info.Singleton {
+		leases.release(t.info.Name)
+	}
+}
+
+func (a *assistant) PauseCallBack(id TimerID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.timers[id]
+	if ok && !t.paused {
+		t.paused = true
+		a.index.unschedule(t)
+	}
+	return ok
+}
+
+func (a *assistant) ResumeCallBack(id TimerID) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.timers[id]
+	if ok && t.paused {
+		t.paused = false
+		a.schedule(t, a.clock.Now())
+	}
+	return ok
+}
+
+// Reschedule replaces the category of the timer.
+func (a *assistant) Reschedule(id TimerID, category CallCategory) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.timers[id]
+	if !ok {
+		return false
+	}
+	a.index.unschedule(t)
+	t.info.Category = category
+	a.setClock(category)
+	if !t.paused {
+		a.schedule(t, a.clock.Now())
+	}
+	return true
+}
+
+// setClock hands the clock of the assistant to the categories reading one.
+func (a *assistant) setClock(category CallCategory) {
+	if c, ok := category.(clockSetter); ok {
+		c.SetClock(a.clock)
+	}
+}
+
+// Process fires the due timers and hands their calls to the owner before
+// returning.
+func (a *assistant) Process() {
+	for _, call := range a.process(a.clock.Now()) {
+		call()
+	}
+}
+
+// process returns the calls of the due timers, the callers hand them to the
+// owner outside of the lock so that callbacks may manage timers themselves.
+// The calls of the named timers are saved before they are returned, a
+// singleton timer whose lease is held elsewhere is moved to its next call
+// without firing.
+func (a *assistant) process(now time.Time) []func() {
+	owner, store, runs, records := a.collect(now)
+	for _, r := range records {
+		if err := store.Save(r); err != nil {
+			log.Println("timerassistant: save", r.Name, err)
+		}
+	}
+
+	calls := make([]func(), len(runs))
+	for i, run := range runs {
+		run := run
+		calls[i] = func() { owner.Execute(run) }
+	}
+	return calls
+}
+
+// collect moves the due timers to their next call and returns their runs
+// and the records to save. The lock is released even if a category panics.
+func (a *assistant) collect(now time.Time) (owner Owner, store TimerStore, runs []func(), records []TimerRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owner, store = a.owner, a.store
+	for _, t := range a.index.collect(now) {
+		scheduled := t.at
+		if t.retry > 0 {
+			retry := t.retry
+			a.schedule(t, now)
+			t.running++
+			runs = append(runs, a.run(t, retry, scheduled))
+			continue
+		}
+		t.info.Category.SetLastCallTime(now.UnixNano())
+		a.schedule(t, now)
+		if !a.leads(t, now) {
+			t.backlog = 0
+			continue
+		}
+		if t.info.Policy.SkipIfRunning && t.running > 0 {
+			t.stats.misses += uint64(t.backlog + 1)
+			t.backlog = 0
+			continue
+		}
+		for calls := t.backlog + 1; calls > 0 && !t.done; calls-- {
+			t.running++
+			t.runs++
+			runs = append(runs, a.run(t, 0, scheduled))
+			if max := t.info.Policy.MaxRuns; max > 0 && t.runs >= max {
+				t.done = true
+				a.index.unschedule(t)
+			}
+		}
+		t.backlog = 0
+		if t.info.Name != "" && store != nil {
+			records = append(records, TimerRecord{Name: t.info.Name, LastCallTime: now.UnixNano()})
+		}
+	}
+	return owner, store, runs, records
+}
+
+func (a *assistant) leads(t *timer, now time.Time) bool {
+	if !t.info.Singleton || a.leases == nil {
+		return true
+	}
+	_, ok := a.leases.holds(t.info.Name, now)
+	return ok
+}
+
+// Loop processes the timers on every tick of the clock and renews the
+// leases until Stop, the tickers are started before Loop returns. Calling
+// Loop again while it runs does nothing.
+func (a *assistant) Loop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	a.stop = stop
+	if a.leases != nil {
+		renew := a.clock.NewTicker(a.leases.conf.RenewInterval)
+		a.loop.Add(1)
+		go func() {
+			defer a.loop.Done()
+			defer renew.Stop()
+			a.RenewLeases()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-renew.C():
+					a.RenewLeases()
+				}
+			}
+		}()
+	}
+	tick := a.clock.NewTicker(a.tickTime)
+	d := newDispatcher()
+	go d.loop()
+	a.loop.Add(1)
+	go func() {
+		defer a.loop.Done()
+		// the dispatcher hands the calls already pushed to the owner and ends
+		defer close(d.ready)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C():
+				a.tick(d)
+			}
+		}
+	}()
+}
+
+// tick processes the due timers, a panic is logged and the next tick runs.
+func (a *assistant) tick(d *dispatcher) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("timerassistant: tick panicked: %v\n%s", err, debug.Stack())
+		}
+	}()
+	d.push(a.process(a.clock.Now()))
+}
+
+// Stop stops the tickers started by Loop and returns once no tick runs, the
+// calls already handed to the owner are not waited for.
+func (a *assistant) Stop() {
+	a.mu.Lock()
+	stop := a.stop
+	a.stop = nil
+	a.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	a.loop.Wait()
+}
+
+// dispatcher hands the calls to the owner on its own goroutine, a slow
+// owner delays the calls but never the ticks.
+type dispatcher struct {
+	mu    sync.Mutex
+	queue []func()
+	ready chan struct{}
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{ready: make(chan struct{}, 1)}
+}
+
+func (d *dispatcher) push(calls []func()) {
+	if len(calls) == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.queue = append(d.queue, calls...)
+	d.mu.Unlock()
+	select {
+	case d.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (d *dispatcher) loop() {
+	for range d.ready {
+		d.mu.Lock()
+		calls := d.queue
+		d.queue = nil
+		d.mu.Unlock()
+		for _, call := range calls {
+			d.call(call)
+		}
+	}
+}
+
+// call runs a call handed to the owner, a panic the owner did not handle is
+// logged, the run already recorded it as the PanicError of the timer.
+func (d *dispatcher) call(call func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("timerassistant: call panicked: %v\n%s", err, debug.Stack())
+		}
+	}()
+	call()
+}
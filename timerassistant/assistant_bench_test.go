@@ -0,0 +1,33 @@
+package timerassistant
+
+import (
+	"testing"
+	"time"
+)
+
+const benchTimers = 10000
+
+func benchmarkProcess(b *testing.B, a *assistant, start time.Time) {
+	for i := 0; i < benchTimers; i++ {
+		a.AddCallBack(&CallInfo{
+			Category: &Interval{Duration: time.Duration(i+1) * time.Second, LastCallTime: start.UnixNano()},
+			Fn:       func() {},
+		})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, call := range a.process(start.Add(time.Duration(i) * time.Millisecond)) {
+			call()
+		}
+	}
+}
+
+func BenchmarkNormalAssistantProcess(b *testing.B) {
+	start := time.Now()
+	benchmarkProcess(b, NewTimerNormalAssistantWithClock(time.Millisecond, NewFakeClock(start)).assistant, start)
+}
+
+func BenchmarkWheelAssistantProcess(b *testing.B) {
+	start := time.Now()
+	benchmarkProcess(b, NewTimerWheelAssistantWithClock(time.Millisecond, NewFakeClock(start)).assistant, start)
+}
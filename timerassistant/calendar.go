@@ -0,0 +1,237 @@
+package timerassistant
+
+import (
+	"fmt"
+	"time"
+)
+
+// calendar is the next fire time model shared by the calendar categories:
+// a category that was called fires at its first occurrence strictly after
+// the last call, one that never was fires at its first occurrence after the
+// first time it is asked. Occurrences are built from the wall clock of
+// Location with time.Date, so a time skipped by a daylight saving
+// transition fires once right after the gap and a repeated one fires once.
+type calendar struct {
+	Location *time.Location
+
+	clock        Clock
+	anchor       time.Time
+	lastCallTime int64
+}
+
+func (c *calendar) location() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+func (c *calendar) now() time.Time {
+	if c.clock == nil {
+		return SystemClock.Now()
+	}
+	return c.clock.Now()
+}
+
+// SetClock sets the clock ShouldCall reads, SystemClock by default.
+func (c *calendar) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+func (c *calendar) SetLastCallTime(lastCallTime int64) {
+	c.lastCallTime = lastCallTime
+}
+
+func (c *calendar) next(now time.Time, after func(time.Time) time.Time) time.Time {
+	if c.lastCallTime != 0 {
+		return after(time.Unix(0, c.lastCallTime))
+	}
+	if c.anchor.IsZero() {
+		c.anchor = now
+	}
+	return after(c.anchor)
+}
+
+func (c *calendar) shouldCall(next func(time.Time) time.Time) bool {
+	now := c.now()
+	at := next(now)
+	return !at.IsZero() && !at.After(now)
+}
+
+// wallClock is time.Date, except that a wall time skipped by a daylight
+// saving transition is moved after the gap where time.Date moves it before.
+func wallClock(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, loc)
+	if t.Hour() == hour && t.Minute() == min && t.Second() == sec {
+		return t
+	}
+	_, before := t.Zone()
+	_, end := t.ZoneBounds()
+	if end.IsZero() {
+		return t
+	}
+	if _, after := end.Zone(); after > before {
+		return t.Add(time.Duration(after-before) * time.Second)
+	}
+	return t
+}
+
+// Daily calls every day at Hour:Min:Sec.
+type Daily struct {
+	Hour int
+	Min  int
+	Sec  int
+	calendar
+}
+
+func NewDaily(hour, min, sec int, loc *time.Location) *Daily {
+	d := &Daily{Hour: hour, Min: min, Sec: sec}
+	d.Location = loc
+	return d
+}
+
+func (d *Daily) ShouldCall() bool {
+	return d.shouldCall(d.Next)
+}
+
+func (d *Daily) String() string {
+	return fmt.Sprintf("daily at %02d:%02d:%02d %s", d.Hour, d.Min, d.Sec, d.location())
+}
+
+func (d *Daily) Next(now time.Time) time.Time {
+	return d.next(now, d.NextAfter)
+}
+
+// NextAfter returns the first occurrence strictly after t.
+func (d *Daily) NextAfter(t time.Time) time.Time {
+	loc := d.location()
+	t = t.In(loc)
+	for days := 0; ; days++ {
+		next := wallClock(t.Year(), t.Month(), t.Day()+days, d.Hour, d.Min, d.Sec, loc)
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Weekly calls every week on WeekDay at Hour:Min:Sec.
+type Weekly struct {
+	WeekDay time.Weekday
+	Hour    int
+	Min     int
+	Sec     int
+	calendar
+}
+
+func NewWeekly(weekDay time.Weekday, hour, min, sec int, loc *time.Location) *Weekly {
+	w := &Weekly{WeekDay: weekDay, Hour: hour, Min: min, Sec: sec}
+	w.Location = loc
+	return w
+}
+
+func (w *Weekly) ShouldCall() bool {
+	return w.shouldCall(w.Next)
+}
+
+func (w *Weekly) String() string {
+	return fmt.Sprintf("weekly on %s at %02d:%02d:%02d %s", w.WeekDay, w.Hour, w.Min, w.Sec, w.location())
+}
+
+func (w *Weekly) Next(now time.Time) time.Time {
+	return w.next(now, w.NextAfter)
+}
+
+// NextAfter returns the first occurrence strictly after t.
+func (w *Weekly) NextAfter(t time.Time) time.Time {
+	loc := w.location()
+	t = t.In(loc)
+	days := (int(w.WeekDay) - int(t.Weekday()) + 7) % 7
+	for ; ; days += 7 {
+		next := wallClock(t.Year(), t.Month(), t.Day()+days, w.Hour, w.Min, w.Sec, loc)
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Monthly calls every month on Day at Hour:Min:Sec, in the months shorter
+// than Day it calls on their last day.
+type Monthly struct {
+	Day  int
+	Hour int
+	Min  int
+	Sec  int
+	calendar
+}
+
+func NewMonthly(day, hour, min, sec int, loc *time.Location) *Monthly {
+	m := &Monthly{Day: day, Hour: hour, Min: min, Sec: sec}
+	m.Location = loc
+	return m
+}
+
+func (m *Monthly) ShouldCall() bool {
+	return m.shouldCall(m.Next)
+}
+
+func (m *Monthly) String() string {
+	return fmt.Sprintf("monthly on day %d at %02d:%02d:%02d %s", m.Day, m.Hour, m.Min, m.Sec, m.location())
+}
+
+func (m *Monthly) Next(now time.Time) time.Time {
+	return m.next(now, m.NextAfter)
+}
+
+// NextAfter returns the first occurrence strictly after t.
+func (m *Monthly) NextAfter(t time.Time) time.Time {
+	loc := m.location()
+	t = t.In(loc)
+	for months := 0; ; months++ {
+		// the day 0 of the next month is the last day of this one
+		last := time.Date(t.Year(), t.Month()+time.Month(months)+1, 0, 0, 0, 0, 0, loc)
+		day := m.Day
+		if day > last.Day() {
+			day = last.Day()
+		}
+		if day < 1 {
+			day = 1
+		}
+		next := wallClock(last.Year(), last.Month(), day, m.Hour, m.Min, m.Sec, loc)
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Date calls once at a given date and time, a date already past when the
+// timer is added fires right away.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+	Hour  int
+	Min   int
+	Sec   int
+	calendar
+}
+
+func NewDate(year int, month time.Month, day, hour, min, sec int, loc *time.Location) *Date {
+	d := &Date{Year: year, Month: month, Day: day, Hour: hour, Min: min, Sec: sec}
+	d.Location = loc
+	return d
+}
+
+func (d *Date) ShouldCall() bool {
+	return d.shouldCall(d.Next)
+}
+
+func (d *Date) String() string {
+	return fmt.Sprintf("on %04d-%02d-%02d %02d:%02d:%02d %s", d.Year, d.Month, d.Day, d.Hour, d.Min, d.Sec, d.location())
+}
+
+func (d *Date) Next(now time.Time) time.Time {
+	if d.lastCallTime != 0 {
+		return time.Time{}
+	}
+	return wallClock(d.Year, d.Month, d.Day, d.Hour, d.Min, d.Sec, d.location())
+}
@@ -0,0 +1,132 @@
+package timerassistant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarNextAfter(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	newYork, _ := time.LoadLocation("America/New_York")
+	at := func(loc *time.Location, s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		name     string
+		category interface{ NextAfter(time.Time) time.Time }
+		loc      *time.Location
+		from     string
+		want     string
+	}{
+		{"daily later today", NewDaily(8, 30, 0, time.UTC), time.UTC, "2024-03-01 08:00:00", "2024-03-01 08:30:00"},
+		{"daily at the time", NewDaily(8, 30, 0, time.UTC), time.UTC, "2024-03-01 08:30:00", "2024-03-02 08:30:00"},
+		{"daily end of year", NewDaily(0, 0, 0, time.UTC), time.UTC, "2024-12-31 23:59:59", "2025-01-01 00:00:00"},
+		{"daily in zone", NewDaily(8, 0, 0, shanghai), shanghai, "2024-03-01 07:00:00", "2024-03-01 08:00:00"},
+		{"daily spring forward gap", NewDaily(2, 30, 0, newYork), newYork, "2024-03-09 02:30:00", "2024-03-10 03:30:00"},
+		{"daily after the gap", NewDaily(2, 30, 0, newYork), newYork, "2024-03-10 03:30:00", "2024-03-11 02:30:00"},
+		{"daily across fall back", NewDaily(12, 0, 0, newYork), newYork, "2024-11-02 12:00:00", "2024-11-03 12:00:00"},
+		{"weekly later this week", NewWeekly(time.Friday, 9, 0, 0, time.UTC), time.UTC, "2024-03-04 10:00:00", "2024-03-08 09:00:00"},
+		{"weekly same day earlier", NewWeekly(time.Monday, 9, 0, 0, time.UTC), time.UTC, "2024-03-04 08:00:00", "2024-03-04 09:00:00"},
+		{"weekly same day later", NewWeekly(time.Monday, 9, 0, 0, time.UTC), time.UTC, "2024-03-04 09:00:00", "2024-03-11 09:00:00"},
+		{"weekly across spring forward", NewWeekly(time.Sunday, 2, 30, 0, newYork), newYork, "2024-03-03 02:30:00", "2024-03-10 03:30:00"},
+		{"monthly later this month", NewMonthly(15, 0, 0, 0, time.UTC), time.UTC, "2024-03-01 00:00:00", "2024-03-15 00:00:00"},
+		{"monthly next month", NewMonthly(15, 0, 0, 0, time.UTC), time.UTC, "2024-03-15 00:00:00", "2024-04-15 00:00:00"},
+		{"monthly clamped to february", NewMonthly(31, 12, 0, 0, time.UTC), time.UTC, "2024-01-31 12:00:00", "2024-02-29 12:00:00"},
+		{"monthly clamped to april", NewMonthly(31, 12, 0, 0, time.UTC), time.UTC, "2024-03-31 12:00:00", "2024-04-30 12:00:00"},
+		{"monthly end of year", NewMonthly(1, 0, 0, 0, time.UTC), time.UTC, "2024-12-01 00:00:00", "2025-01-01 00:00:00"},
+	}
+	for _, c := range cases {
+		got := c.category.NextAfter(at(c.loc, c.from))
+		if want := at(c.loc, c.want); !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+// TestCalendarFallBack checks that a wall time repeated by the fall back
+// transition fires once.
+func TestCalendarFallBack(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	d := NewDaily(1, 30, 0, newYork)
+	first := d.NextAfter(time.Date(2024, 11, 2, 12, 0, 0, 0, newYork))
+	if first.Day() != 3 || first.Hour() != 1 || first.Minute() != 30 {
+		t.Fatalf("got %v", first)
+	}
+	next := d.NextAfter(first)
+	if want := time.Date(2024, 11, 4, 1, 30, 0, 0, newYork); !next.Equal(want) {
+		t.Fatalf("got %v, want %v", next, want)
+	}
+	// the second 01:30 is an hour after the first one
+	if next = d.NextAfter(first.Add(time.Hour)); !next.Equal(time.Date(2024, 11, 4, 1, 30, 0, 0, newYork)) {
+		t.Fatalf("got %v", next)
+	}
+}
+
+func TestCalendarShouldCall(t *testing.T) {
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	cases := []struct {
+		name     string
+		category interface {
+			CallCategory
+			SetClock(Clock)
+		}
+		steps []struct {
+			at   time.Duration
+			want bool
+		}
+	}{
+		{name: "daily", category: NewDaily(8, 0, 0, time.UTC), steps: []struct {
+			at   time.Duration
+			want bool
+		}{
+			{0, false},
+			{time.Hour - time.Second, false},
+			{time.Hour, true},
+			{time.Hour + time.Second, false},
+			{25 * time.Hour, true},
+		}},
+		{name: "weekly", category: NewWeekly(time.Sunday, 7, 0, 0, time.UTC), steps: []struct {
+			at   time.Duration
+			want bool
+		}{
+			{0, false},
+			{24 * time.Hour, false},
+			{48 * time.Hour, true},
+			{9 * 24 * time.Hour, true},
+		}},
+		{name: "monthly", category: NewMonthly(31, 7, 0, 0, time.UTC), steps: []struct {
+			at   time.Duration
+			want bool
+		}{
+			{0, false},
+			{30 * 24 * time.Hour, true},
+			{31 * 24 * time.Hour, false},
+			{60 * 24 * time.Hour, true},
+		}},
+		{name: "date", category: NewDate(2024, time.March, 2, 7, 0, 0, time.UTC), steps: []struct {
+			at   time.Duration
+			want bool
+		}{
+			{0, false},
+			{24 * time.Hour, true},
+			{48 * time.Hour, false},
+		}},
+	}
+	for _, c := range cases {
+		c.category.SetClock(clock)
+		for _, step := range c.steps {
+			clock.Set(start.Add(step.at))
+			if got := c.category.ShouldCall(); got != step.want {
+				t.Fatalf("%s at %v: got %v, want %v", c.name, clock.Now(), got, step.want)
+			}
+			if step.want {
+				c.category.SetLastCallTime(clock.Now().UnixNano())
+			}
+		}
+	}
+}
@@ -1,46 +1,73 @@
 package timerassistant
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type CallCategory interface {
 	ShouldCall() bool
 	SetLastCallTime(int642 int64)
+	// Next returns the time of the next call as seen at now, a time not
+	// after now means the call is due and the zero time means never.
+	Next(now time.Time) time.Time
 }
 
 type Interval struct {
 	Duration     time.Duration
 	LastCallTime int64
+
+	clock Clock
+	// delayed waits a Duration from the first time the interval is asked
+	// before the first call.
+	delayed bool
 }
 
 func NewInterval(duration time.Duration, ShouldNowExecute bool) *Interval {
-	interval := &Interval{
-		Duration:     duration,
-		LastCallTime: 0,
-	}
-	if !ShouldNowExecute {
-		interval.LastCallTime = time.Now().UnixNano()
+	return &Interval{
+		Duration: duration,
+		delayed:  !ShouldNowExecute,
 	}
-	return interval
+}
+
+// SetClock sets the clock ShouldCall reads, SystemClock by default.
+func (i *Interval) SetClock(clock Clock) {
+	i.clock = clock
 }
 
 func (i *Interval) ShouldCall() bool {
-	curTime := time.Now()
-	curUnixNano := curTime.UnixNano()
-	if curUnixNano-i.LastCallTime < int64(i.Duration) {
-		return false
+	now := SystemClock.Now()
+	if i.clock != nil {
+		now = i.clock.Now()
 	}
-	return true
+	return !i.Next(now).After(now)
 }
 
 func (i *Interval) SetLastCallTime(timeStamp int64) {
 	i.LastCallTime = timeStamp
 }
 
+func (i *Interval) String() string {
+	return "every " + i.Duration.String()
+}
+
+func (i *Interval) Next(now time.Time) time.Time {
+	if i.LastCallTime == 0 {
+		if !i.delayed {
+			return now
+		}
+		i.LastCallTime = now.UnixNano()
+	}
+	return time.Unix(0, i.LastCallTime).Add(i.Duration)
+}
+
+// Once calls a single time at Hour:Min:Sec of the day it is first asked,
+// right away when that time is already past.
 type Once struct {
-	Hour         int
-	Min          int
-	Sec          int
-	lastCallTime int64
+	Hour int
+	Min  int
+	Sec  int
+	calendar
 }
 
 func NewOnce(hour, min, sec int) *Once {
@@ -52,61 +79,21 @@ func NewOnce(hour, min, sec int) *Once {
 }
 
 func (o *Once) ShouldCall() bool {
-	if o.lastCallTime != 0 {
-		return false
-	}
-	now := time.Now()
-	hour, min, sec := now.Local().Clock()
-	if (hour*3600 + min*60 + sec) >= (o.Hour*3600 + o.Min*60 + o.Sec) {
-		return true
-	}
-	return false
-}
-func (o *Once) SetLastCallTime(lastCallTime int64) {
-	o.lastCallTime = lastCallTime
+	return o.shouldCall(o.Next)
 }
 
-type Daily struct {
-	Hour         int
-	Min          int
-	Sec          int
-	lastCallTime int64
+func (o *Once) String() string {
+	return fmt.Sprintf("once at %02d:%02d:%02d %s", o.Hour, o.Min, o.Sec, o.location())
 }
 
-func NewDaily(hour, min, sec int) *Daily {
-	return &Daily{
-		Hour: hour,
-		Min:  min,
-		Sec:  sec,
+func (o *Once) Next(now time.Time) time.Time {
+	if o.lastCallTime != 0 {
+		return time.Time{}
 	}
-}
-
-func (d *Daily) ShouldCall() bool {
-	now := time.Now().Local()
-	hour, min, sec := now.Clock()
-	nowSec := hour*3660 + min*60 + sec
-
-	if d.lastCallTime == 0 {
-		if nowSec >= (d.Hour*3600 + d.Hour*60 + d.Sec) {
-			return true
-		}
-	} else {
-		if nowSec >= (d.Hour*3600+d.Hour*60+d.Sec) && int(nowSec-int(d.lastCallTime)) >= 86400 {
-			return true
-		}
+	if o.anchor.IsZero() {
+		o.anchor = now
 	}
-
-	return false
-}
-
-func (d *Daily) SetLastCallTime(lastCallTime int64) {
-	d.lastCallTime = lastCallTime
-
-}
-
-type Weekly struct {
-	WeekDay int
-	Hour    int
-	Min     int
-	S       int
+	loc := o.location()
+	day := o.anchor.In(loc)
+	return wallClock(day.Year(), day.Month(), day.Day(), o.Hour, o.Min, o.Sec, loc)
 }
@@ -0,0 +1,69 @@
+package timerassistant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockTicker(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tick := clock.NewTicker(time.Second)
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-tick.C():
+		t.Fatal("ticked early")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	if got := <-tick.C(); !got.Equal(start.Add(time.Second)) {
+		t.Fatalf("got %v", got)
+	}
+	// missed ticks are dropped
+	clock.Advance(10 * time.Second)
+	<-tick.C()
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-tick.C():
+		t.Fatal("ticked between periods")
+	default:
+	}
+	tick.Stop()
+	clock.Advance(time.Hour)
+	select {
+	case <-tick.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+}
+
+// TestFakeClockSchedules runs four weeks of schedules hour by hour.
+func TestFakeClockSchedules(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) // a Friday
+	for name, newAssistant := range map[string]func(Clock) TimerAssistant{
+		"normal": func(c Clock) TimerAssistant { return NewTimerNormalAssistantWithClock(time.Second, c) },
+		"wheel":  func(c Clock) TimerAssistant { return NewTimerWheelAssistantWithClock(time.Second, c) },
+	} {
+		clock := NewFakeClock(start)
+		a := newAssistant(clock)
+		fired := make(map[string]int)
+		add := func(name string, category CallCategory) {
+			a.AddCallBack(&CallInfo{Category: category, Fn: func() { fired[name]++ }})
+		}
+		add("interval", NewInterval(6*time.Hour, false))
+		add("daily", NewDaily(9, 0, 0, time.UTC))
+		add("weekly", NewWeekly(time.Monday, 9, 0, 0, time.UTC))
+		add("monthly", NewMonthly(15, 0, 0, 0, time.UTC))
+		add("date", NewDate(2024, time.March, 20, 12, 0, 0, time.UTC))
+		for i := 0; i < 28*24; i++ {
+			clock.Advance(time.Hour)
+			a.(interface{ Process() }).Process()
+		}
+		want := map[string]int{"interval": 112, "daily": 28, "weekly": 4, "monthly": 1, "date": 1}
+		for k, n := range want {
+			if fired[k] != n {
+				t.Errorf("%s: %s fired %d times, want %d", name, k, fired[k], n)
+			}
+		}
+	}
+}
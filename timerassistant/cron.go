@@ -0,0 +1,321 @@
+package timerassistant
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// cronAllHours is the hour field of an expression matching every hour.
+const cronAllHours = 1<<24 - 1
+
+// cronSearchYears bounds the search of an expression that never matches, like 0 0 30 2 *.
+const cronSearchYears = 5
+
+// Cron calls on a cron expression: "minute hour dom month dow", the same
+// with a leading seconds field, or one of the @yearly, @monthly, @weekly,
+// @daily and @hourly macros. Fields accept *, ?, lists, ranges, steps and
+// the JAN-DEC and SUN-SAT names. A CRON_TZ= or TZ= prefix selects the time
+// zone, otherwise the location given to NewCron is used.
+type Cron struct {
+	Expr string
+
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+	calendar
+}
+
+func NewCron(expr string, loc *time.Location) (*Cron, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	c := &Cron{Expr: expr}
+	c.Location = loc
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("cron %q: missing fields after time zone", expr)
+		}
+		tz := spec[strings.IndexByte(spec, '=')+1 : i]
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		c.Location, spec = l, strings.TrimSpace(spec[i:])
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron %q: expected 5 or 6 fields, got %d", expr, len(fields))
+	}
+
+	var err error
+	targets := []*uint64{&c.second, &c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	specs := []cronField{cronSecond, cronMinute, cronHour, cronDom, cronMonth, cronDow}
+	for i, field := range specs {
+		if *targets[i], err = field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[3] == "*" || fields[3] == "?"
+	c.dowStar = fields[5] == "*" || fields[5] == "?"
+	return c, nil
+}
+
+func (f cronField) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(spec, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rangeSpec := item
+		i := strings.IndexByte(item, '/')
+		if i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: bad step in %q", f.name, item)
+			}
+			rangeSpec = item[:i]
+		}
+		switch {
+		case rangeSpec == "*" || rangeSpec == "?":
+		case strings.Contains(rangeSpec, "-"):
+			bounds := strings.SplitN(rangeSpec, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rangeSpec)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if i < 0 {
+				hi = v
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("%s: bad range %q", f.name, item)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: bad value %q", f.name, s)
+	}
+	return v, nil
+}
+
+func (c *Cron) ShouldCall() bool {
+	return c.shouldCall(c.Next)
+}
+
+func (c *Cron) String() string {
+	return "cron " + c.Expr
+}
+
+// Next returns the first match after the last call, or after the first
+// time the cron was asked when it was never called.
+func (c *Cron) Next(now time.Time) time.Time {
+	return c.next(now, c.NextAfter)
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	// as in Vixie cron, restricting both fields matches either of them
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// NextAfter returns the first time strictly after t matching the
+// expression, or the zero time if none is found within five years. Like the
+// calendar categories, a wall time skipped by a daylight saving gap fires
+// once after the gap, see skipped, and an expression with fixed hours fires
+// once at a wall time repeated by a fall back: 30 1 * * * calls at 01:30
+// before the clocks go back, not again an hour later.
+func (c *Cron) NextAfter(t time.Time) time.Time {
+	origin := t.Location()
+	t = t.In(c.location()).Add(time.Second - time.Duration(t.Nanosecond()))
+	next := c.search(t)
+	for !next.IsZero() && c.hour != cronAllHours && repeated(next) {
+		next = c.search(next.Add(time.Second))
+	}
+	limit := next
+	if limit.IsZero() {
+		limit = t.AddDate(cronSearchYears, 0, 0)
+	}
+	if skipped := c.skipped(t, limit); !skipped.IsZero() {
+		next = skipped
+	}
+	if next.IsZero() {
+		return next
+	}
+	return next.In(origin)
+}
+
+// search returns the first existing wall time from t on matching the expression.
+func (c *Cron) search(t time.Time) time.Time {
+	loc := t.Location()
+	yearLimit := t.Year() + cronSearchYears
+	truncated := false
+
+wrap:
+	for t.Year() <= yearLimit {
+		for c.month&(1<<uint(t.Month())) == 0 {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 1, 0)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+		for !c.dayMatches(t) {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 0, 1)
+			// midnight may not exist on a daylight saving transition day
+			if t.Hour() != 0 {
+				if t.Hour() > 12 {
+					t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+				} else {
+					t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+				}
+			}
+			if t.Day() == 1 {
+				continue wrap
+			}
+		}
+		for c.hour&(1<<uint(t.Hour())) == 0 {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+			}
+			t = t.Add(time.Hour)
+			if t.Hour() == 0 {
+				continue wrap
+			}
+		}
+		for c.minute&(1<<uint(t.Minute())) == 0 {
+			if !truncated {
+				truncated = true
+				t = t.Truncate(time.Minute)
+			}
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+		for c.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			if t.Second() == 0 {
+				continue wrap
+			}
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// skipped returns the first match lost in a daylight saving gap between from
+// and to, moved after the gap by the gap length as wallClock does: 02:30 is
+// called at 03:30 when 02:00 jumps to 03:00. Only the first match of a gap is
+// returned so that an expression matching the whole gap fires once.
+func (c *Cron) skipped(from, to time.Time) time.Time {
+	for _, end := from.ZoneBounds(); !end.IsZero() && end.Before(to); _, end = end.ZoneBounds() {
+		_, before := end.Add(-time.Second).Zone()
+		_, after := end.Zone()
+		if after <= before {
+			continue
+		}
+		// the wall clock of the gap keeps the offset before the transition
+		wall := end.In(time.FixedZone("", before))
+		for s := 0; s < after-before; s++ {
+			w := wall.Add(time.Duration(s) * time.Second)
+			if c.matches(w) {
+				if !w.Before(to) {
+					return time.Time{}
+				}
+				return w.In(from.Location())
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// repeated reports whether the wall time of t already passed before a
+// daylight saving fall back.
+func repeated(t time.Time) bool {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return false
+	}
+	_, before := start.Add(-time.Second).Zone()
+	_, after := t.Zone()
+	return before > after && t.Sub(start) < time.Duration(before-after)*time.Second
+}
+
+func (c *Cron) matches(t time.Time) bool {
+	return c.month&(1<<uint(t.Month())) != 0 && c.dayMatches(t) &&
+		c.hour&(1<<uint(t.Hour())) != 0 && c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.second&(1<<uint(t.Second())) != 0
+}
@@ -0,0 +1,111 @@
+package timerassistant
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestCronNextAfter(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	newYork, _ := time.LoadLocation("America/New_York")
+	at := func(loc *time.Location, s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		expr string
+		loc  *time.Location
+		from string
+		want string
+	}{
+		{"* * * * *", time.UTC, "2024-03-01 10:00:30", "2024-03-01 10:01:00"},
+		{"*/15 * * * * *", time.UTC, "2024-03-01 10:00:30", "2024-03-01 10:00:45"},
+		{"0 9-17/4 * * MON-FRI", time.UTC, "2024-03-01 13:00:00", "2024-03-01 17:00:00"},
+		{"0 9-17/4 * * MON-FRI", time.UTC, "2024-03-01 17:00:00", "2024-03-04 09:00:00"},
+		{"30 2 1,15 * *", time.UTC, "2024-03-02 00:00:00", "2024-03-15 02:30:00"},
+		{"0 0 29 FEB *", time.UTC, "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 1 * 1", time.UTC, "2024-03-01 12:00:00", "2024-03-04 00:00:00"},
+		{"0 12 * JAN,jul SUN", time.UTC, "2024-03-01 00:00:00", "2024-07-07 12:00:00"},
+		{"0 0 * * 7", time.UTC, "2024-03-01 00:00:00", "2024-03-03 00:00:00"},
+		{"@hourly", time.UTC, "2024-03-01 10:59:59", "2024-03-01 11:00:00"},
+		{"@daily", time.UTC, "2024-12-31 10:00:00", "2025-01-01 00:00:00"},
+		{"@weekly", time.UTC, "2024-03-01 10:00:00", "2024-03-03 00:00:00"},
+		{"@monthly", time.UTC, "2024-03-01 00:00:00", "2024-04-01 00:00:00"},
+		{"@yearly", time.UTC, "2024-03-01 00:00:00", "2025-01-01 00:00:00"},
+		{"0 8 * * *", shanghai, "2024-03-01 09:00:00", "2024-03-02 08:00:00"},
+		{"CRON_TZ=Asia/Shanghai 0 8 * * *", time.UTC, "2024-03-01 09:00:00", "2024-03-02 08:00:00"},
+		// 02:30 does not exist on the spring forward day, it fires once after the gap like Daily
+		{"30 2 * * *", newYork, "2024-03-09 03:00:00", "2024-03-10 03:30:00"},
+		{"30 2 * * *", newYork, "2024-03-10 03:30:00", "2024-03-11 02:30:00"},
+		{"TZ=America/New_York 30 2 * * *", time.UTC, "2024-03-10 01:59:00", "2024-03-10 03:30:00"},
+		{"*/15 2 * * *", newYork, "2024-03-10 01:50:00", "2024-03-10 03:00:00"},
+		{"*/15 2 * * *", newYork, "2024-03-10 03:00:00", "2024-03-11 02:00:00"},
+		{"0 4 * * *", newYork, "2024-03-10 01:00:00", "2024-03-10 04:00:00"},
+		{"30 1 * * *", newYork, "2024-11-02 02:00:00", "2024-11-03 01:30:00"},
+		{"0 0 30 2 *", time.UTC, "2024-03-01 00:00:00", ""},
+	}
+	// 01:30 is repeated on the fall back day, it fires once like Daily while
+	// an expression of every hour fires in both
+	firstHalfPast := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)
+	for _, c := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"30 1 * * *", time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC)},
+		{"*/30 1 * * *", time.Date(2024, 11, 4, 6, 0, 0, 0, time.UTC)},
+		{"30 * * * *", firstHalfPast.Add(time.Hour)},
+	} {
+		cron, _ := NewCron(c.expr, newYork)
+		if got := cron.NextAfter(firstHalfPast); !got.Equal(c.want) {
+			t.Errorf("%s after the first 01:30: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+	daily := NewDaily(1, 30, 0, newYork)
+	if got := daily.NextAfter(firstHalfPast); !got.Equal(time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC)) {
+		t.Errorf("Daily after the first 01:30: got %v", got)
+	}
+	for _, c := range cases {
+		cron, err := NewCron(c.expr, c.loc)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		loc := cron.Location
+		got := cron.NextAfter(at(loc, c.from))
+		if c.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s: got %v, want never", c.expr, got)
+			}
+			continue
+		}
+		if want := at(loc, c.want); !got.Equal(want) {
+			t.Errorf("%s from %s: got %v, want %v", c.expr, c.from, got, want)
+		}
+	}
+}
+
+func TestCronParseError(t *testing.T) {
+	for _, expr := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * FOO *", "TZ=Nowhere/Land * * * * *",
+	} {
+		if _, err := NewCron(expr, time.UTC); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	cron, _ := NewCron("0 * * * *", time.UTC)
+	now := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	if got := cron.Next(now); !got.Equal(now.Add(30 * time.Minute)) {
+		t.Fatalf("got %v", got)
+	}
+	cron.SetLastCallTime(now.Add(30 * time.Minute).UnixNano())
+	if got := cron.Next(now); !got.Equal(now.Add(90 * time.Minute)) {
+		t.Fatalf("got %v", got)
+	}
+}
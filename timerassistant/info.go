@@ -1,16 +1,22 @@
 package timerassistant
 
-import "time"
+import "context"
 
 type CallInfo struct {
-	Category     CallCategory
-	Fn           func()
-	ResumeCallCh chan func()
-}
+	Category CallCategory
+	Fn       func()
+	// Task is the job of the timer when it needs a context or reports an
+	// error, it replaces Fn.
+	Task   func(ctx context.Context) error
+	Policy Policy
 
-func (cb *CallInfo) NotifyOwner() {
-	if cb.Category.ShouldCall() {
-		cb.ResumeCallCh <- cb.Fn
-		cb.Category.SetLastCallTime(time.Now().UnixNano())
-	}
+	// Name identifies the timer in the TimerStore of the assistant, an
+	// unnamed timer is not persisted.
+	Name string
+	// Misfire tells what to do with the calls missed while the process
+	// was down when a named timer is restored.
+	Misfire MisfirePolicy
+	// Singleton fires the named timer only on the replica holding its lease,
+	// the others let the call go by. It needs the leases of the assistant.
+	Singleton bool
 }
@@ -0,0 +1,141 @@
+package timerassistant
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const DefaultLeaseTTL = 15 * time.Second
+
+var ErrLeaseHeld = errors.New("lease held by another holder")
+
+// Lease grants its holder the right to fire a singleton timer until it
+// expires. Token grows every time the lease changes hands, the jobs pass it
+// along with their writes so that a stale holder can be fenced off.
+type Lease struct {
+	Name    string    `bson:"_id"`
+	Holder  string    `bson:"holder"`
+	Token   int64     `bson:"token"`
+	Expires time.Time `bson:"expires"`
+}
+
+type LeaseStore interface {
+	// Acquire takes or renews the lease for holder until now+ttl, it fails
+	// with ErrLeaseHeld while the lease of another holder has not expired.
+	Acquire(name, holder string, now time.Time, ttl time.Duration) (Lease, error)
+	// Release gives the lease up if holder holds it.
+	Release(name, holder string) error
+}
+
+type LeaseConfig struct {
+	Store LeaseStore
+	// Holder identifies this replica.
+	Holder string
+	TTL    time.Duration
+	// RenewInterval is the period of the renewals done by Loop, a third of
+	// TTL by default.
+	RenewInterval time.Duration
+}
+
+func (c *LeaseConfig) defaults() {
+	if c.TTL <= 0 {
+		c.TTL = DefaultLeaseTTL
+	}
+	if c.RenewInterval <= 0 {
+		c.RenewInterval = c.TTL / 3
+	}
+}
+
+// leaser tracks the leases held by the assistant.
+type leaser struct {
+	conf LeaseConfig
+
+	mu   sync.Mutex
+	held map[string]Lease
+}
+
+func newLeaser(conf LeaseConfig) *leaser {
+	conf.defaults()
+	return &leaser{conf: conf, held: make(map[string]Lease)}
+}
+
+func (l *leaser) holds(name string, now time.Time) (Lease, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lease, ok := l.held[name]
+	if !ok || !now.Before(lease.Expires) {
+		return Lease{}, false
+	}
+	return lease, true
+}
+
+// renew acquires or renews the leases of names and forgets the others.
+func (l *leaser) renew(names []string, now time.Time) {
+	held := make(map[string]Lease, len(names))
+	for _, name := range names {
+		lease, err := l.conf.Store.Acquire(name, l.conf.Holder, now, l.conf.TTL)
+		if err != nil {
+			if !errors.Is(err, ErrLeaseHeld) {
+				log.Println("timerassistant: acquire lease", name, err)
+			}
+			continue
+		}
+		held[name] = lease
+	}
+	l.mu.Lock()
+	l.held = held
+	l.mu.Unlock()
+}
+
+func (l *leaser) release(name string) {
+	l.mu.Lock()
+	_, ok := l.held[name]
+	delete(l.held, name)
+	l.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := l.conf.Store.Release(name, l.conf.Holder); err != nil {
+		log.Println("timerassistant: release lease", name, err)
+	}
+}
+
+// MemoryLeaseStore keeps the leases of the replicas of a single process,
+// mostly for tests.
+type MemoryLeaseStore struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+}
+
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{leases: make(map[string]Lease)}
+}
+
+func (s *MemoryLeaseStore) Acquire(name, holder string, now time.Time, ttl time.Duration) (Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lease, ok := s.leases[name]
+	if ok && lease.Holder != holder && now.Before(lease.Expires) {
+		return Lease{}, ErrLeaseHeld
+	}
+	if lease.Holder != holder {
+		lease.Token++
+		lease.Holder = holder
+	}
+	lease.Name = name
+	lease.Expires = now.Add(ttl)
+	s.leases[name] = lease
+	return lease, nil
+}
+
+func (s *MemoryLeaseStore) Release(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease, ok := s.leases[name]; ok && lease.Holder == holder {
+		lease.Expires = time.Time{}
+		s.leases[name] = lease
+	}
+	return nil
+}
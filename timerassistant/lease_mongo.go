@@ -0,0 +1,59 @@
+package timerassistant
+
+import (
+	"errors"
+	"time"
+
+	"github.com/AlphaMinZ/alpha_broker/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLeaseStore keeps the leases in a collection, one document per lease
+// with the name as _id. A lease is taken with a single upsert matching only
+// when it is free, expired or already ours, so two replicas never both get it.
+type MongoLeaseStore struct {
+	MongoCollection
+}
+
+func NewMongoLeaseStore(client *mongo.Client, dbName, collName string) *MongoLeaseStore {
+	return &MongoLeaseStore{newMongoCollection(client, dbName, collName)}
+}
+
+func (s *MongoLeaseStore) Acquire(name, holder string, now time.Time, ttl time.Duration) (Lease, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{bson.M{"holder": holder}, bson.M{"expires": bson.M{"$lte": now}}},
+	}
+	// the token only grows when the holder changes
+	update := bson.A{bson.M{"$set": bson.M{
+		"token": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$holder", holder}},
+			"$token",
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$token", 0}}, 1}},
+		}},
+		"holder":  holder,
+		"expires": now.Add(ttl),
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var lease Lease
+	err := s.Client.FindOneAndUpdateWithOption(ctx, s.DBName, s.CollName, filter, update, opts).Decode(&lease)
+	if errors.Is(err, mongo.ErrDuplicateKey) {
+		// the lease exists and the filter did not match: someone else holds it
+		return Lease{}, ErrLeaseHeld
+	}
+	if err != nil {
+		return Lease{}, err
+	}
+	return lease, nil
+}
+
+func (s *MongoLeaseStore) Release(name, holder string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err := s.Client.UpdateOne(ctx, s.DBName, s.CollName,
+		bson.M{"_id": name, "holder": holder}, bson.M{"$set": bson.M{"expires": time.Time{}}})
+	return err
+}
@@ -0,0 +1,93 @@
+package timerassistant
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryLeaseStore(t *testing.T) {
+	s := NewMemoryLeaseStore()
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, err := s.Acquire("job", "a", now, 10*time.Second)
+	if err != nil || a.Token != 1 {
+		t.Fatalf("got %v %v", a, err)
+	}
+	if _, err := s.Acquire("job", "b", now.Add(5*time.Second), 10*time.Second); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("got %v", err)
+	}
+	if a, _ = s.Acquire("job", "a", now.Add(5*time.Second), 10*time.Second); a.Token != 1 {
+		t.Fatalf("renewal changed the token: %v", a)
+	}
+	b, err := s.Acquire("job", "b", now.Add(15*time.Second), 10*time.Second)
+	if err != nil || b.Token != 2 {
+		t.Fatalf("got %v %v", b, err)
+	}
+	s.Release("job", "a")
+	if _, err := s.Acquire("job", "a", now.Add(16*time.Second), 10*time.Second); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("released a lease held by another holder: %v", err)
+	}
+	s.Release("job", "b")
+	if a, _ = s.Acquire("job", "a", now.Add(16*time.Second), 10*time.Second); a.Token != 3 {
+		t.Fatalf("got %v", a)
+	}
+}
+
+// TestSingletonTimer runs two replicas of an hourly job, only the lease
+// holder fires and the other takes over once the holder stops renewing.
+func TestSingletonTimer(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryLeaseStore()
+	fired := make(map[string]int)
+	replicas := make(map[string]*TimerWheelAssistant)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		r := NewTimerWheelAssistantWithClock(time.Second, clock)
+		r.SetLeases(LeaseConfig{Store: store, Holder: name, TTL: time.Minute})
+		r.AddCallBack(&CallInfo{
+			Name:      "hourly",
+			Singleton: true,
+			Category:  mustCron(t, "0 * * * *"),
+			Fn:        func() { fired[name]++ },
+		})
+		replicas[name] = r
+	}
+	replicas["a"].RenewLeases()
+	replicas["b"].RenewLeases()
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Hour)
+		replicas["a"].RenewLeases()
+		replicas["b"].RenewLeases()
+		replicas["a"].Process()
+		replicas["b"].Process()
+	}
+	if fired["a"] != 3 || fired["b"] != 0 {
+		t.Fatalf("got %v", fired)
+	}
+	lease, ok := replicas["a"].Lease("hourly")
+	if !ok || lease.Token != 1 {
+		t.Fatalf("got %v %v", lease, ok)
+	}
+
+	// a stops renewing, b gets the lease once it expires
+	clock.Advance(59 * time.Minute)
+	replicas["b"].RenewLeases()
+	clock.Advance(time.Minute)
+	replicas["b"].RenewLeases()
+	replicas["a"].Process()
+	replicas["b"].Process()
+	if fired["a"] != 3 || fired["b"] != 1 {
+		t.Fatalf("got %v", fired)
+	}
+	if lease, _ := replicas["b"].Lease("hourly"); lease.Token != 2 {
+		t.Fatalf("got %v", lease)
+	}
+}
+
+func mustCron(t *testing.T, expr string) *Cron {
+	c, err := NewCron(expr, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -11,23 +11,26 @@ type TOwner struct {
 	o        TimerAssistant
 }
 
-func (o *TOwner) Execute(func()) {
+func (o *TOwner) Execute(fn func()) {
 	fmt.Println("Execute")
+	o.resumeCh <- fn
 }
 
 func (o TOwner) loop() {
 	for {
 		select {
 		case fn := <-o.resumeCh:
-			o.Execute(fn)
+			fn()
 		}
 	}
 }
 
 func TestNormalAssistant(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 22, 0, 0, 0, time.Local))
+	called := make(chan struct{})
 	tn := &TOwner{
 		resumeCh: make(chan func(), 1),
-		o:        NewTimerNormalAssistant(time.Second),
+		o:        NewTimerNormalAssistantWithClock(time.Second, clock),
 	}
 	tn.o.AddCallBack(&CallInfo{
 		Category: &Once{
@@ -37,11 +40,50 @@ func TestNormalAssistant(t *testing.T) {
 		},
 		Fn: func() {
 			fmt.Println("fn inner")
+			close(called)
 		},
-		ResumeCallCh: tn.resumeCh,
 	})
+	tn.o.AssertOwner(tn)
 	go tn.loop()
-	go tn.o.Loop()
-	select {}
+	tn.o.Loop()
 
+	clock.Advance(34 * time.Minute)
+	select {
+	case <-called:
+		t.Fatal("called before 22:35")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("not called at 22:35")
+	}
+}
+
+func TestNormalAssistantHandle(t *testing.T) {
+	var fired []string
+	owner := OwnerFunc(func(fn func()) { fn() })
+	a := NewTimerNormalAssistant(time.Second)
+	a.AssertOwner(owner)
+	id := a.AddCallBack(&CallInfo{
+		Category: NewInterval(0, true),
+		Fn:       func() { fired = append(fired, "a") },
+	})
+	a.Process()
+	a.PauseCallBack(id)
+	a.Process()
+	a.ResumeCallBack(id)
+	a.Reschedule(id, NewInterval(time.Hour, false))
+	a.Process()
+	a.Reschedule(id, NewInterval(0, true))
+	a.Process()
+	a.DelCallBack(id)
+	a.Process()
+	if len(fired) != 2 {
+		t.Fatalf("got %v", fired)
+	}
+	if a.PauseCallBack(id) {
+		t.Fatal("deleted timer paused")
+	}
 }
@@ -1,57 +1,39 @@
 package timerassistant
 
-import (
-	"fmt"
-	"sync"
-	"time"
-)
+import "time"
 
+// TimerNormalAssistant checks every timer for its next call on each
+// tick, which costs O(n) per tick.
 type TimerNormalAssistant struct {
-	tickTime  time.Duration
-	callbacks sync.Map
+	*assistant
 }
 
 func NewTimerNormalAssistant(tickTime time.Duration) *TimerNormalAssistant {
-	return &TimerNormalAssistant{
-		tickTime: tickTime,
-	}
+	return NewTimerNormalAssistantWithClock(tickTime, SystemClock)
 }
 
-func (t *TimerNormalAssistant) AssertOwner(owner Owner) {
-
+func NewTimerNormalAssistantWithClock(tickTime time.Duration, clock Clock) *TimerNormalAssistant {
+	return &TimerNormalAssistant{
+		assistant: newAssistant(tickTime, make(scanIndex), clock),
+	}
 }
 
-func (t *TimerNormalAssistant) AddCallBack(info *CallInfo) {
-	t.callbacks.Store(info, struct{}{})
-}
+type scanIndex map[*timer]struct{}
 
-func (t *TimerNormalAssistant) DelCallBack(info *CallInfo) {
-	t.callbacks.Delete(info)
+func (s scanIndex) schedule(t *timer) {
+	s[t] = struct{}{}
 }
 
-func (t *TimerNormalAssistant) Process() {
-	t.callbacks.Range(func(key, value any) bool {
-		cbInfo := key.(*CallInfo)
-		cbInfo.NotifyOwner()
-		return true
-	})
+func (s scanIndex) unschedule(t *timer) {
+	delete(s, t)
 }
 
-func (t *TimerNormalAssistant) Loop() {
-	go func() {
-		tick := time.NewTicker(t.tickTime)
-		defer func() {
-			tick.Stop()
-			err := recover()
-			if err != nil {
-				fmt.Println(err)
-			}
-		}()
-		for {
-			select {
-			case <-tick.C:
-				t.Process()
-			}
+func (s scanIndex) collect(now time.Time) []*timer {
+	var due []*timer
+	for t := range s {
+		if !t.at.IsZero() && !t.at.After(now) {
+			due = append(due, t)
 		}
-	}()
+	}
+	return due
 }
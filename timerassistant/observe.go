@@ -0,0 +1,202 @@
+package timerassistant
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historySize is the count of runs a timer remembers.
+const historySize = 16
+
+// latenessBuckets are the upper bounds in seconds of the lateness histogram.
+var latenessBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60}
+
+// RunRecord describes a run of a timer, Scheduled is the time it was due.
+type RunRecord struct {
+	Scheduled time.Time
+	Started   time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// TimerInfo describes a timer, Next is zero when it is paused or never due
+// again.
+type TimerInfo struct {
+	ID       TimerID
+	Name     string
+	Category string
+	Paused   bool
+	Running  int
+
+	Next         time.Time
+	LastFire     time.Time
+	LastDuration time.Duration
+	LastError    error
+
+	// Fires counts the runs, Misses the calls let go by while the previous
+	// run was still running or missed while the process was down.
+	Fires    uint64
+	Misses   uint64
+	Failures uint64
+	// History holds the last runs, the oldest first.
+	History []RunRecord
+}
+
+type timerStats struct {
+	fires, misses, failures uint64
+	last                    RunRecord
+	history                 [historySize]RunRecord
+	recorded                int
+	lateness                histogram
+}
+
+func (s *timerStats) record(r RunRecord) {
+	s.last = r
+	if r.Err != nil {
+		s.failures++
+	}
+	s.history[s.recorded%historySize] = r
+	s.recorded++
+}
+
+func (s *timerStats) runs() []RunRecord {
+	n := s.recorded
+	if n > historySize {
+		n = historySize
+	}
+	runs := make([]RunRecord, 0, n)
+	for i := s.recorded - n; i < s.recorded; i++ {
+		runs = append(runs, s.history[i%historySize])
+	}
+	return runs
+}
+
+type histogram struct {
+	counts [11]uint64 // one per bucket and +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(latenessBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// describe names the category, its String method when it has one.
+func describe(category CallCategory) string {
+	if s, ok := category.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", category)
+}
+
+func (a *assistant) info(t *timer) TimerInfo {
+	info := TimerInfo{
+		ID:           t.id,
+		Name:         t.info.Name,
+		Category:     describe(t.info.Category),
+		Paused:       t.paused,
+		Running:      t.running,
+		LastFire:     t.stats.last.Started,
+		LastDuration: t.stats.last.Duration,
+		LastError:    t.stats.last.Err,
+		Fires:        t.stats.fires,
+		Misses:       t.stats.misses,
+		Failures:     t.stats.failures,
+		History:      t.stats.runs(),
+	}
+	if !t.paused {
+		info.Next = t.at
+	}
+	return info
+}
+
+// List describes the timers ordered by ID.
+func (a *assistant) List() []TimerInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list := make([]TimerInfo, 0, len(a.timers))
+	for _, t := range a.timers {
+		list = append(list, a.info(t))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (a *assistant) Describe(id TimerID) (TimerInfo, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.timers[id]
+	if !ok {
+		return TimerInfo{}, false
+	}
+	return a.info(t), true
+}
+
+// WriteMetrics writes the metrics of the timers in the Prometheus text
+// format, labelled by timer name or by ID for the unnamed ones.
+func (a *assistant) WriteMetrics(w io.Writer) error {
+	type sample struct {
+		label string
+		stats timerStats
+	}
+	a.mu.Lock()
+	samples := make([]sample, 0, len(a.timers))
+	for _, t := range a.timers {
+		label := t.info.Name
+		if label == "" {
+			label = strconv.FormatUint(uint64(t.id), 10)
+		}
+		samples = append(samples, sample{label, t.stats})
+	}
+	a.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i].label < samples[j].label })
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# HELP timerassistant_timers Timers registered.\n")
+	fmt.Fprintf(b, "# TYPE timerassistant_timers gauge\n")
+	fmt.Fprintf(b, "timerassistant_timers %d\n", len(samples))
+	counters := []struct {
+		name, help string
+		value      func(*timerStats) uint64
+	}{
+		{"timerassistant_fires_total", "Runs of the timer.", func(s *timerStats) uint64 { return s.fires }},
+		{"timerassistant_misses_total", "Calls of the timer let go by.", func(s *timerStats) uint64 { return s.misses }},
+		{"timerassistant_failures_total", "Runs of the timer that failed.", func(s *timerStats) uint64 { return s.failures }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for i := range samples {
+			fmt.Fprintf(b, "%s{timer=\"%s\"} %d\n", c.name, escapeLabel(samples[i].label), c.value(&samples[i].stats))
+		}
+	}
+	const lateness = "timerassistant_lateness_seconds"
+	fmt.Fprintf(b, "# HELP %s Delay between the time a run was due and the time it started.\n", lateness)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", lateness)
+	for i := range samples {
+		label, h := escapeLabel(samples[i].label), &samples[i].stats.lateness
+		var cumulative uint64
+		for j, le := range latenessBuckets {
+			cumulative += h.counts[j]
+			fmt.Fprintf(b, "%s_bucket{timer=\"%s\",le=\"%s\"} %d\n", lateness, label,
+				strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{timer=\"%s\",le=\"+Inf\"} %d\n", lateness, label, h.count)
+		fmt.Fprintf(b, "%s_sum{timer=\"%s\"} %s\n", lateness, label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_count{timer=\"%s\"} %d\n", lateness, label, h.count)
+	}
+	return b.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,144 @@
+package timerassistant
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	a := NewTimerWheelAssistantWithClock(time.Second, clock)
+	errFailed := errors.New("failed")
+	report := a.AddCallBack(&CallInfo{
+		Name:     "report",
+		Category: NewDaily(9, 0, 0, time.UTC),
+		Task: func(ctx context.Context) error {
+			clock.Advance(2 * time.Second)
+			return errFailed
+		},
+	})
+	tick := a.AddCallBack(&CallInfo{Category: NewInterval(time.Minute, false), Fn: func() {}})
+	a.PauseCallBack(tick)
+
+	info, ok := a.Describe(report)
+	if !ok || info.Name != "report" || info.Category != "daily at 09:00:00 UTC" ||
+		!info.Next.Equal(start.Add(9*time.Hour)) || !info.LastFire.IsZero() {
+		t.Fatalf("got %+v", info)
+	}
+
+	clock.Set(start.Add(9*time.Hour + 3*time.Second))
+	a.Process()
+	info, _ = a.Describe(report)
+	if info.Fires != 1 || info.Failures != 1 || !errors.Is(info.LastError, errFailed) ||
+		info.LastDuration != 2*time.Second || !info.LastFire.Equal(start.Add(9*time.Hour+3*time.Second)) ||
+		!info.Next.Equal(start.Add(33*time.Hour)) || len(info.History) != 1 {
+		t.Fatalf("got %+v", info)
+	}
+
+	list := a.List()
+	if len(list) != 2 || list[0].ID != report || list[1].ID != tick || !list[1].Paused ||
+		!list[1].Next.IsZero() || list[1].Category != "every 1m0s" {
+		t.Fatalf("got %+v", list)
+	}
+	if _, ok := a.Describe(TimerID(42)); ok {
+		t.Fatal("described an unknown timer")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	id := a.AddCallBack(&CallInfo{Category: NewInterval(time.Second, false), Fn: func() {}})
+	for i := 0; i < historySize+4; i++ {
+		clock.Advance(time.Second)
+		a.Process()
+	}
+	info, _ := a.Describe(id)
+	if info.Fires != historySize+4 || len(info.History) != historySize {
+		t.Fatalf("got %d fires, %d runs", info.Fires, len(info.History))
+	}
+	if !info.History[historySize-1].Started.Equal(clock.Now()) ||
+		!info.History[0].Started.Equal(clock.Now().Add(-(historySize-1)*time.Second)) {
+		t.Fatalf("got %+v", info.History)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	owner := &heldOwner{}
+	a.AssertOwner(owner)
+	a.AddCallBack(&CallInfo{
+		Name:     `job "a"`,
+		Category: NewInterval(time.Minute, false),
+		Policy:   Policy{SkipIfRunning: true},
+		Fn:       func() {},
+	})
+	clock.Advance(time.Minute)
+	a.Process()
+	clock.Advance(time.Minute)
+	a.Process()
+	// the run held since the first minute starts 62s late
+	clock.Advance(2 * time.Second)
+	owner.runAll()
+
+	var b strings.Builder
+	if err := a.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"timerassistant_timers 1",
+		"# TYPE timerassistant_fires_total counter",
+		`timerassistant_fires_total{timer="job \"a\""} 1`,
+		`timerassistant_misses_total{timer="job \"a\""} 1`,
+		`timerassistant_failures_total{timer="job \"a\""} 0`,
+		"# TYPE timerassistant_lateness_seconds histogram",
+		`timerassistant_lateness_seconds_bucket{timer="job \"a\"",le="60"} 0`,
+		`timerassistant_lateness_seconds_bucket{timer="job \"a\"",le="+Inf"} 1`,
+		`timerassistant_lateness_seconds_sum{timer="job \"a\""} 62`,
+		`timerassistant_lateness_seconds_count{timer="job \"a\""} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, b.String())
+		}
+	}
+}
+
+func TestDescribePanic(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	id := a.AddCallBack(&CallInfo{Name: "sync", Category: NewInterval(time.Second, false), Fn: func() { panic("boom") }})
+	clock.Advance(time.Second)
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("the owner got %v", r)
+			}
+		}()
+		a.Process()
+	}()
+
+	info, _ := a.Describe(id)
+	var perr *PanicError
+	if !errors.As(info.LastError, &perr) || perr.Name != "sync" || perr.Value != "boom" ||
+		!strings.Contains(string(perr.Stack), "TestDescribePanic") || info.Failures != 1 {
+		t.Fatalf("got %+v", info)
+	}
+	if got := info.LastError.Error(); got != "timerassistant: timer sync panicked: boom" {
+		t.Fatal(got)
+	}
+
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+	newDispatcher().call(func() { panic("boom") })
+	if !strings.Contains(buf.String(), "timerassistant: call panicked: boom") {
+		t.Fatalf("got log %q", buf.String())
+	}
+}
@@ -1,5 +1,33 @@
 package timerassistant
 
+import alphaBroker "github.com/AlphaMinZ/alpha_broker"
+
+// Owner executes the fired callbacks, usually on its own goroutine.
 type Owner interface {
 	Execute(func())
 }
+
+// OwnerFunc adapts a function to the Owner interface.
+type OwnerFunc func(func())
+
+func (f OwnerFunc) Execute(fn func()) {
+	f(fn)
+}
+
+// inlineOwner runs the callbacks on the timer goroutine when no owner is asserted.
+var inlineOwner = OwnerFunc(func(fn func()) {
+	fn()
+})
+
+// ComponentOwner executes the callbacks as operations of a component.
+type ComponentOwner struct {
+	Component alphaBroker.Component
+}
+
+func NewComponentOwner(c alphaBroker.Component) *ComponentOwner {
+	return &ComponentOwner{Component: c}
+}
+
+func (o *ComponentOwner) Execute(fn func()) {
+	o.Component.Resolve(alphaBroker.Operation{Cb: fn})
+}
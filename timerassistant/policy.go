@@ -0,0 +1,142 @@
+package timerassistant
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"time"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+)
+
+const (
+	DefaultRetryBackoff    = time.Second
+	DefaultRetryMaxBackoff = time.Minute
+)
+
+// Policy tells how the calls of a timer are run.
+type Policy struct {
+	// Jitter delays every call by a random duration up to Jitter.
+	Jitter time.Duration
+	// SkipIfRunning lets a call go by while the previous one still runs.
+	SkipIfRunning bool
+	// Timeout cancels the context of a Task running longer.
+	Timeout time.Duration
+	Retry   RetryPolicy
+	// MaxRuns removes the timer once that many calls ran, 0 means no limit.
+	MaxRuns int
+}
+
+// RetryPolicy runs a failed call again after an exponential backoff. The
+// retry is scheduled like a call of the timer, a retry due after the next
+// call is dropped.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	backoff, max := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	return alphaBroker.Backoff(backoff, max, retry)
+}
+
+func (p *Policy) jitter() time.Duration {
+	if p.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(p.Jitter)))
+}
+
+// PanicError is the LastError of a timer whose call panicked.
+type PanicError struct {
+	ID    TimerID
+	Name  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("timerassistant: timer %s panicked: %v", e.Name, e.Value)
+	}
+	return fmt.Sprintf("timerassistant: timer %d panicked: %v", e.ID, e.Value)
+}
+
+// invoke runs the Task, or Fn for the timers without one.
+func (info *CallInfo) invoke() error {
+	if info.Task == nil {
+		if info.Fn != nil {
+			info.Fn()
+		}
+		return nil
+	}
+	ctx := context.Background()
+	if info.Policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, info.Policy.Timeout)
+		defer cancel()
+	}
+	return info.Task(ctx)
+}
+
+// run returns the call of the timer handed to the owner, retry counts the
+// retries before it and scheduled is the time it was due.
+func (a *assistant) run(t *timer, retry int, scheduled time.Time) func() {
+	return func() {
+		started := a.clock.Now()
+		a.mu.Lock()
+		t.stats.fires++
+		if !scheduled.IsZero() {
+			t.stats.lateness.observe(started.Sub(scheduled).Seconds())
+		}
+		a.mu.Unlock()
+
+		var err error
+		defer func() {
+			// a panic is reported as an error, then left to the owner
+			r := recover()
+			if r != nil {
+				err = &PanicError{ID: t.id, Name: t.info.Name, Value: r, Stack: debug.Stack()}
+			}
+			a.finish(t, retry, RunRecord{
+				Scheduled: scheduled,
+				Started:   started,
+				Duration:  a.clock.Now().Sub(started),
+				Err:       err,
+			})
+			if r != nil {
+				panic(r)
+			}
+		}()
+		err = t.info.invoke()
+	}
+}
+
+// finish records the run, schedules the retry of a failed one and removes
+// a timer whose last run is over.
+func (a *assistant) finish(t *timer, retry int, r RunRecord) {
+	a.mu.Lock()
+	t.running--
+	t.stats.record(r)
+	if r.Err != nil && retry < t.info.Policy.Retry.MaxRetries && a.timers[t.id] == t && !t.paused {
+		at := a.clock.Now().Add(t.info.Policy.Retry.backoff(retry + 1))
+		if t.done || t.at.IsZero() || at.Before(t.at) {
+			a.index.unschedule(t)
+			t.at, t.retry = at, retry+1
+			a.index.schedule(t)
+		}
+	}
+	remove := t.done && t.running == 0 && t.retry == 0
+	a.mu.Unlock()
+	if remove {
+		a.DelCallBack(t.id)
+	}
+}
@@ -0,0 +1,229 @@
+package timerassistant
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// heldOwner keeps the calls until the test runs them.
+type heldOwner struct {
+	calls []func()
+}
+
+func (o *heldOwner) Execute(fn func()) {
+	o.calls = append(o.calls, fn)
+}
+
+func (o *heldOwner) runAll() {
+	calls := o.calls
+	o.calls = nil
+	for _, fn := range calls {
+		fn()
+	}
+}
+
+func TestPolicyJitter(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	a := NewTimerWheelAssistantWithClock(time.Second, clock)
+	var fired []time.Time
+	a.AddCallBack(&CallInfo{
+		Category: NewDaily(1, 0, 0, time.UTC),
+		Policy:   Policy{Jitter: 10 * time.Minute},
+		Fn:       func() { fired = append(fired, clock.Now()) },
+	})
+	for i := 0; i < 3*24*60; i++ {
+		clock.Advance(time.Minute)
+		a.Process()
+	}
+	if len(fired) != 3 {
+		t.Fatalf("got %v", fired)
+	}
+	for i, at := range fired {
+		due := start.AddDate(0, 0, i).Add(time.Hour)
+		if at.Before(due) || !at.Before(due.Add(10*time.Minute+time.Minute)) {
+			t.Fatalf("call %d at %v, due at %v", i, at, due)
+		}
+	}
+}
+
+func TestPolicySkipIfRunning(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	owner := &heldOwner{}
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	a.AssertOwner(owner)
+	runs := 0
+	a.AddCallBack(&CallInfo{
+		Category: NewInterval(time.Minute, false),
+		Policy:   Policy{SkipIfRunning: true},
+		Fn:       func() { runs++ },
+	})
+	clock.Advance(time.Minute)
+	a.Process()
+	clock.Advance(time.Minute)
+	a.Process()
+	if len(owner.calls) != 1 {
+		t.Fatalf("%d calls handed while running", len(owner.calls))
+	}
+	owner.runAll()
+	clock.Advance(time.Minute)
+	a.Process()
+	owner.runAll()
+	if runs != 2 {
+		t.Fatalf("got %d runs", runs)
+	}
+}
+
+func TestPolicyTimeout(t *testing.T) {
+	a := NewTimerNormalAssistant(time.Second)
+	errCh := make(chan error, 1)
+	a.AddCallBack(&CallInfo{
+		Category: NewInterval(time.Hour, true),
+		Policy:   Policy{Timeout: 10 * time.Millisecond},
+		Task: func(ctx context.Context) error {
+			<-ctx.Done()
+			errCh <- ctx.Err()
+			return ctx.Err()
+		},
+	})
+	a.Process()
+	if err := <-errCh; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestPolicyRetry(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerWheelAssistantWithClock(time.Millisecond, clock)
+	var attempts []time.Duration
+	start := clock.Now()
+	a.AddCallBack(&CallInfo{
+		Category: NewInterval(time.Hour, false),
+		Policy:   Policy{Retry: RetryPolicy{MaxRetries: 3, Backoff: time.Second}},
+		Task: func(ctx context.Context) error {
+			attempts = append(attempts, clock.Now().Sub(start))
+			if len(attempts) < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	})
+	for i := 0; i < 2*3600; i++ {
+		clock.Advance(time.Second)
+		a.Process()
+	}
+	want := []time.Duration{time.Hour, time.Hour + time.Second, time.Hour + 3*time.Second, 2 * time.Hour}
+	if len(attempts) != len(want) {
+		t.Fatalf("got %v, want %v", attempts, want)
+	}
+	for i := range want {
+		if attempts[i] != want[i] {
+			t.Fatalf("got %v, want %v", attempts, want)
+		}
+	}
+}
+
+func TestPolicyMaxRuns(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	runs := 0
+	id := a.AddCallBack(&CallInfo{
+		Category: NewInterval(time.Minute, true),
+		Policy:   Policy{MaxRuns: 2},
+		Fn:       func() { runs++ },
+	})
+	for i := 0; i < 5; i++ {
+		a.Process()
+		clock.Advance(time.Minute)
+	}
+	if runs != 2 {
+		t.Fatalf("got %d runs", runs)
+	}
+	if a.PauseCallBack(id) {
+		t.Fatal("timer kept after its last run")
+	}
+}
+
+// TestLoopSlowOwner checks that an owner never taking the calls does not
+// stop the ticks.
+func TestLoopSlowOwner(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryTimerStore()
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	a.SetStore(store)
+	a.AssertOwner(OwnerFunc(func(func()) { select {} }))
+	a.AddCallBack(&CallInfo{Name: "job", Category: NewInterval(time.Second, false), Fn: func() {}})
+	a.Loop()
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		want := clock.Now().UnixNano()
+		deadline := time.Now().Add(time.Second)
+		for {
+			if r, _, _ := store.Load("job"); r.LastCallTime == want {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("tick %d not processed", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// panickingCategory panics the first time it is called.
+type panickingCategory struct {
+	*Interval
+	panicked chan struct{}
+}
+
+func (c *panickingCategory) SetLastCallTime(lastCallTime int64) {
+	select {
+	case <-c.panicked:
+		c.Interval.SetLastCallTime(lastCallTime)
+	default:
+		close(c.panicked)
+		panic("bad category")
+	}
+}
+
+// TestLoopPanic checks that a panic in a tick does not stop the ticks, and
+// that Loop starts once and ends with Stop.
+func TestLoopPanic(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+	clock := NewFakeClock(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	a := NewTimerNormalAssistantWithClock(time.Second, clock)
+	bad := &panickingCategory{NewInterval(time.Second, false), make(chan struct{})}
+	a.AddCallBack(&CallInfo{Category: bad, Fn: func() {}})
+	fired := make(chan struct{}, 10)
+	a.AddCallBack(&CallInfo{Category: NewInterval(2*time.Second, false), Fn: func() { fired <- struct{}{} }})
+	a.Loop()
+	a.Loop()
+	clock.mu.Lock()
+	tickers := len(clock.tickers)
+	clock.mu.Unlock()
+	if tickers != 1 {
+		t.Fatalf("%d tickers after two Loops", tickers)
+	}
+
+	clock.Advance(time.Second)
+	<-bad.panicked
+	clock.Advance(time.Second)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("no tick after the panic")
+	}
+
+	a.Stop()
+	clock.Advance(2 * time.Second)
+	select {
+	case <-fired:
+		t.Fatal("fired after Stop")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,143 @@
+package timerassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+
+	alphaBroker "github.com/AlphaMinZ/alpha_broker"
+)
+
+// misfireLimit bounds the missed calls MisfireFireAll replays.
+const misfireLimit = 1024
+
+type MisfirePolicy int
+
+const (
+	// MisfireFireOnce calls once right away for all the missed calls.
+	MisfireFireOnce MisfirePolicy = iota
+	// MisfireFireAll calls right away once for every missed call.
+	MisfireFireAll
+	// MisfireSkip drops the missed calls and waits for the next one.
+	MisfireSkip
+)
+
+// TimerRecord is what a TimerStore keeps of a named timer.
+type TimerRecord struct {
+	Name         string `json:"name" bson:"_id"`
+	LastCallTime int64  `json:"last_call_time" bson:"last_call_time"`
+}
+
+// TimerStore keeps the named timers of an assistant, a timer added again
+// under the same name after a restart resumes from its last call.
+type TimerStore interface {
+	Load(name string) (TimerRecord, bool, error)
+	Save(record TimerRecord) error
+	Delete(name string) error
+	List() ([]TimerRecord, error)
+}
+
+type MemoryTimerStore struct {
+	mu      sync.Mutex
+	records map[string]TimerRecord
+}
+
+func NewMemoryTimerStore() *MemoryTimerStore {
+	return &MemoryTimerStore{records: make(map[string]TimerRecord)}
+}
+
+func (s *MemoryTimerStore) Load(name string) (TimerRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[name]
+	return r, ok, nil
+}
+
+func (s *MemoryTimerStore) Save(record TimerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Name] = record
+	return nil
+}
+
+func (s *MemoryTimerStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, name)
+	return nil
+}
+
+func (s *MemoryTimerStore) List() ([]TimerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedRecords(s.records), nil
+}
+
+func sortedRecords(records map[string]TimerRecord) []TimerRecord {
+	list := make([]TimerRecord, 0, len(records))
+	for _, r := range records {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FileTimerStore keeps the records in a JSON file, rewritten through a
+// temporary file renamed over it so that a crash never leaves it torn.
+type FileTimerStore struct {
+	path string
+	mem  *MemoryTimerStore
+	mu   sync.Mutex // serializes the writes of the file
+}
+
+func NewFileTimerStore(path string) (*FileTimerStore, error) {
+	s := &FileTimerStore{path: path, mem: NewMemoryTimerStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []TimerRecord
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		s.mem.records[r.Name] = r
+	}
+	return s, nil
+}
+
+func (s *FileTimerStore) Load(name string) (TimerRecord, bool, error) {
+	return s.mem.Load(name)
+}
+
+func (s *FileTimerStore) Save(record TimerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.Save(record)
+	return s.flush()
+}
+
+func (s *FileTimerStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.Delete(name)
+	return s.flush()
+}
+
+func (s *FileTimerStore) List() ([]TimerRecord, error) {
+	return s.mem.List()
+}
+
+func (s *FileTimerStore) flush() error {
+	list, _ := s.mem.List()
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return alphaBroker.WriteFileAtomic(s.path, data)
+}
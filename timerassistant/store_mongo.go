@@ -0,0 +1,92 @@
+package timerassistant
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlphaMinZ/alpha_broker/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultStoreTimeout = 5 * time.Second
+
+// MongoCollection is the collection a Mongo store keeps its documents in.
+type MongoCollection struct {
+	Client   *mongo.Client
+	DBName   string
+	CollName string
+	// Timeout bounds every call to the database.
+	Timeout time.Duration
+}
+
+func newMongoCollection(client *mongo.Client, dbName, collName string) MongoCollection {
+	return MongoCollection{
+		Client:   client,
+		DBName:   dbName,
+		CollName: collName,
+		Timeout:  DefaultStoreTimeout,
+	}
+}
+
+func (c *MongoCollection) context() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStoreTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// MongoTimerStore keeps the records in a collection, one document per
+// timer with the name as _id.
+type MongoTimerStore struct {
+	MongoCollection
+}
+
+func NewMongoTimerStore(client *mongo.Client, dbName, collName string) *MongoTimerStore {
+	return &MongoTimerStore{newMongoCollection(client, dbName, collName)}
+}
+
+func (s *MongoTimerStore) Load(name string) (TimerRecord, bool, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	var r TimerRecord
+	err := s.Client.FindOne(ctx, s.DBName, s.CollName, bson.M{"_id": name}).Decode(&r)
+	if errors.Is(err, mongo.ErrNotFound) {
+		return TimerRecord{}, false, nil
+	}
+	if err != nil {
+		return TimerRecord{}, false, err
+	}
+	return r, true, nil
+}
+
+func (s *MongoTimerStore) Save(record TimerRecord) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err := s.Client.ReplaceOneWithOption(ctx, s.DBName, s.CollName, bson.M{"_id": record.Name}, record,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoTimerStore) Delete(name string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err := s.Client.DeleteOne(ctx, s.DBName, s.CollName, bson.M{"_id": name})
+	return err
+}
+
+func (s *MongoTimerStore) List() ([]TimerRecord, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	cursor, err := s.Client.FindWithOption(ctx, s.DBName, s.CollName, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var list []TimerRecord
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
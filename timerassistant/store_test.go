@@ -0,0 +1,154 @@
+package timerassistant
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileTimerStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.json")
+	s, err := NewFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Save(TimerRecord{Name: "b", LastCallTime: 2})
+	s.Save(TimerRecord{Name: "a", LastCallTime: 1})
+	s.Save(TimerRecord{Name: "c"})
+	s.Delete("c")
+
+	reopened, err := NewFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ := reopened.List()
+	want := []TimerRecord{{Name: "a", LastCallTime: 1}, {Name: "b", LastCallTime: 2}}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %v, want %v", list, want)
+	}
+	if r, ok, _ := reopened.Load("b"); !ok || r.LastCallTime != 2 {
+		t.Fatalf("got %v %v", r, ok)
+	}
+	if _, ok, _ := reopened.Load("c"); ok {
+		t.Fatal("deleted record loaded")
+	}
+}
+
+// TestTimerRestore fires a daily job, restarts two days later and checks
+// each misfire policy.
+func TestTimerRestore(t *testing.T) {
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		misfire MisfirePolicy
+		want    int
+	}{
+		{MisfireFireOnce, 1},
+		{MisfireFireAll, 2},
+		{MisfireSkip, 0},
+	}
+	for _, c := range cases {
+		store := NewMemoryTimerStore()
+		clock := NewFakeClock(start)
+		a := NewTimerWheelAssistantWithClock(time.Second, clock)
+		a.SetStore(store)
+		fired := 0
+		add := func(a TimerAssistant) {
+			a.AddCallBack(&CallInfo{
+				Name:     "report",
+				Misfire:  c.misfire,
+				Category: NewDaily(9, 0, 0, time.UTC),
+				Fn:       func() { fired++ },
+			})
+		}
+		add(a)
+		if r, ok, _ := store.Load("report"); !ok || r.LastCallTime != 0 {
+			t.Fatalf("not registered: %v %v", r, ok)
+		}
+		clock.Advance(time.Hour)
+		a.Process()
+		if r, _, _ := store.Load("report"); fired != 1 || r.LastCallTime != clock.Now().UnixNano() {
+			t.Fatalf("fired %d, record %v", fired, r)
+		}
+
+		// restart on the third day at noon, the calls of the second and
+		// third days were missed
+		clock.Set(start.Add(52 * time.Hour))
+		restarted := NewTimerWheelAssistantWithClock(time.Second, clock)
+		restarted.SetStore(store)
+		fired = 0
+		add(restarted)
+		clock.Advance(time.Second)
+		restarted.Process()
+		if fired != c.want {
+			t.Errorf("misfire %d: fired %d, want %d", c.misfire, fired, c.want)
+		}
+		clock.Set(start.Add(73 * time.Hour))
+		restarted.Process()
+		if fired != c.want+1 {
+			t.Errorf("misfire %d: fired %d on the next day, want %d", c.misfire, fired, c.want+1)
+		}
+	}
+}
+
+func TestTimerRestoreOnce(t *testing.T) {
+	store := NewMemoryTimerStore()
+	clock := NewFakeClock(time.Date(2024, 3, 1, 8, 0, 0, 0, time.Local))
+	fired := 0
+	for restart := 0; restart < 2; restart++ {
+		a := NewTimerNormalAssistantWithClock(time.Second, clock)
+		a.SetStore(store)
+		id := a.AddCallBack(&CallInfo{Name: "once", Category: NewOnce(9, 0, 0), Fn: func() { fired++ }})
+		clock.Advance(2 * time.Hour)
+		a.Process()
+		if restart == 1 {
+			a.DelCallBack(id)
+		}
+	}
+	if fired != 1 {
+		t.Fatalf("fired %d times", fired)
+	}
+	if list, _ := store.List(); len(list) != 0 {
+		t.Fatalf("deleted timer kept: %v", list)
+	}
+}
+
+// blockingStore holds Load until release is closed.
+type blockingStore struct {
+	*MemoryTimerStore
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Load(name string) (TimerRecord, bool, error) {
+	close(s.loading)
+	<-s.release
+	return s.MemoryTimerStore.Load(name)
+}
+
+func TestTimerStoreOutsideLock(t *testing.T) {
+	store := &blockingStore{NewMemoryTimerStore(), make(chan struct{}), make(chan struct{})}
+	clock := NewFakeClock(time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC))
+	a := NewTimerWheelAssistantWithClock(time.Second, clock)
+	a.SetStore(store)
+	fired := 0
+	a.AddCallBack(&CallInfo{Category: NewDaily(9, 0, 0, time.UTC), Fn: func() { fired++ }})
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		a.AddCallBack(&CallInfo{Name: "report", Category: NewDaily(9, 0, 0, time.UTC), Fn: func() {}})
+	}()
+
+	// the other timers fire while the store is loading the named one
+	<-store.loading
+	clock.Advance(time.Hour)
+	a.Process()
+	close(store.release)
+	<-added
+	if fired != 1 {
+		t.Fatalf("fired %d", fired)
+	}
+	if _, ok, _ := store.MemoryTimerStore.Load("report"); !ok {
+		t.Fatal("named timer not registered")
+	}
+}
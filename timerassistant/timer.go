@@ -1,8 +1,28 @@
 package timerassistant
 
+import "io"
+
+// TimerID is the handle returned by AddCallBack.
+type TimerID uint64
+
 type TimerAssistant interface {
-	AddCallBack(*CallInfo)
-	DelCallBack(*CallInfo)
+	AddCallBack(*CallInfo) TimerID
+	DelCallBack(TimerID)
+	PauseCallBack(TimerID) bool
+	ResumeCallBack(TimerID) bool
+	Reschedule(TimerID, CallCategory) bool
 	Loop()
+	Stop()
 	AssertOwner(owner Owner)
+	SetStore(store TimerStore)
+	SetLeases(conf LeaseConfig)
+	Lease(name string) (Lease, bool)
+	List() []TimerInfo
+	Describe(TimerID) (TimerInfo, bool)
+	WriteMetrics(w io.Writer) error
 }
+
+var (
+	_ TimerAssistant = (*TimerNormalAssistant)(nil)
+	_ TimerAssistant = (*TimerWheelAssistant)(nil)
+)
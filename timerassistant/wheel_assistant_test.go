@@ -0,0 +1,103 @@
+package timerassistant
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestWheelAssistant(t *testing.T) {
+	start := time.Now()
+	a := NewTimerWheelAssistantWithClock(time.Millisecond, NewFakeClock(start))
+	fired := make(map[string]int)
+	add := func(name string, d time.Duration) TimerID {
+		return a.AddCallBack(&CallInfo{
+			Category: &Interval{Duration: d, LastCallTime: start.UnixNano()},
+			Fn:       func() { fired[name]++ },
+		})
+	}
+	add("5ms", 5*time.Millisecond)
+	add("100ms", 100*time.Millisecond)
+	add("10s", 10*time.Second)
+	add("3d", 72*time.Hour)
+	paused := add("paused", 5*time.Millisecond)
+	a.PauseCallBack(paused)
+
+	steps := []struct {
+		at   time.Duration
+		want map[string]int
+	}{
+		{4 * time.Millisecond, map[string]int{}},
+		{5 * time.Millisecond, map[string]int{"5ms": 1}},
+		{99 * time.Millisecond, map[string]int{"5ms": 2}},
+		{100 * time.Millisecond, map[string]int{"5ms": 2, "100ms": 1}},
+		{10 * time.Second, map[string]int{"5ms": 3, "100ms": 2, "10s": 1}},
+		{72 * time.Hour, map[string]int{"5ms": 4, "100ms": 3, "10s": 2, "3d": 1}},
+	}
+	for _, step := range steps {
+		for _, call := range a.process(start.Add(step.at)) {
+			call()
+		}
+		for name, n := range step.want {
+			if fired[name] != n {
+				t.Fatalf("at %v: got %v, want %v", step.at, fired, step.want)
+			}
+		}
+		if len(fired) != len(step.want) {
+			t.Fatalf("at %v: got %v, want %v", step.at, fired, step.want)
+		}
+	}
+}
+
+func TestWheelFarTimer(t *testing.T) {
+	start := time.Now()
+	w := newWheelIndex(time.Millisecond, start)
+	far := &timer{info: &CallInfo{
+		Category: &Interval{Duration: 1000 * 24 * time.Hour, LastCallTime: start.UnixNano()},
+	}}
+	far.at = far.info.Category.Next(start)
+	w.schedule(far)
+	if due := w.collect(start.Add(800 * 24 * time.Hour)); len(due) != 0 {
+		t.Fatalf("fired early: %v", due)
+	}
+	if due := w.collect(start.Add(1000 * 24 * time.Hour)); len(due) != 1 {
+		t.Fatalf("got %v", due)
+	}
+}
+
+func TestWheelRandom(t *testing.T) {
+	start := time.Now()
+	w := newWheelIndex(time.Millisecond, start)
+	r := rand.New(rand.NewSource(1))
+	timers := make([]*timer, 2000)
+	for i := range timers {
+		d := time.Duration(r.Int63n(int64(30 * 24 * time.Hour)))
+		if i%2 == 0 {
+			d = time.Duration(r.Int63n(int64(10 * time.Second)))
+		}
+		timers[i] = &timer{id: TimerID(i), info: &CallInfo{
+			Category: &Interval{Duration: d, LastCallTime: start.UnixNano()},
+		}}
+		timers[i].at = timers[i].info.Category.Next(start)
+		w.schedule(timers[i])
+	}
+	fired := make(map[TimerID]bool)
+	now := start
+	for len(fired) < len(timers) {
+		now = now.Add(time.Duration(r.Int63n(int64(time.Hour))))
+		if r.Intn(2) == 0 {
+			now = now.Add(time.Duration(r.Int63n(int64(time.Second))))
+		}
+		for _, tm := range w.collect(now) {
+			if fired[tm.id] || tm.at.After(now) {
+				t.Fatalf("timer %d at %v fired at %v", tm.id, tm.at, now)
+			}
+			fired[tm.id] = true
+		}
+		for _, tm := range timers {
+			if !fired[tm.id] && !tm.at.After(now.Add(-time.Millisecond)) {
+				t.Fatalf("timer %d at %v missed at %v", tm.id, tm.at, now)
+			}
+		}
+	}
+}
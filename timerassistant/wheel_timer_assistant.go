@@ -0,0 +1,160 @@
+package timerassistant
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	wheelBits   = 6
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 6
+	// wheelSpan is the farthest expiry in ticks the wheel holds, later
+	// timers are parked at the end of the last level and placed again.
+	wheelSpan = 1<<(wheelBits*wheelLevels) - 1
+)
+
+// TimerWheelAssistant keeps the timers in a hierarchical timing wheel, a
+// tick only touches the timers due in that tick. With a tick of one
+// millisecond the wheel spans about two years.
+type TimerWheelAssistant struct {
+	*assistant
+}
+
+func NewTimerWheelAssistant(tickTime time.Duration) *TimerWheelAssistant {
+	return NewTimerWheelAssistantWithClock(tickTime, SystemClock)
+}
+
+func NewTimerWheelAssistantWithClock(tickTime time.Duration, clock Clock) *TimerWheelAssistant {
+	return &TimerWheelAssistant{
+		assistant: newAssistant(tickTime, newWheelIndex(tickTime, clock.Now()), clock),
+	}
+}
+
+type wheelIndex struct {
+	tick    time.Duration
+	start   time.Time
+	current uint64 // ticks since start
+	levels  [wheelLevels][wheelSize]*list.List
+	counts  [wheelLevels]int
+}
+
+func newWheelIndex(tick time.Duration, start time.Time) *wheelIndex {
+	w := &wheelIndex{tick: tick, start: start}
+	for level := range w.levels {
+		for slot := range w.levels[level] {
+			w.levels[level][slot] = list.New()
+		}
+	}
+	return w
+}
+
+// ticks rounds up, a timer never fires before its time.
+func (w *wheelIndex) ticks(at time.Time) uint64 {
+	d := at.Sub(w.start)
+	if d <= 0 {
+		return 0
+	}
+	return uint64((d + w.tick - 1) / w.tick)
+}
+
+func (w *wheelIndex) schedule(t *timer) {
+	w.unschedule(t)
+	if t.at.IsZero() {
+		return
+	}
+	w.insert(t, w.current+1)
+}
+
+// insert places the timer in its slot, no earlier than the earliest tick.
+func (w *wheelIndex) insert(t *timer, earliest uint64) {
+	t.expire = w.ticks(t.at)
+	if t.expire < earliest {
+		t.expire = earliest
+	}
+	delta := t.expire - w.current
+	if delta > wheelSpan {
+		t.expire = w.current + wheelSpan
+		delta = wheelSpan
+	}
+	level := 0
+	for level < wheelLevels-1 && delta >= 1<<(wheelBits*(level+1)) {
+		level++
+	}
+	t.level = level
+	t.slot = w.levels[level][(t.expire>>(wheelBits*level))&wheelMask]
+	t.elem = t.slot.PushBack(t)
+	w.counts[level]++
+}
+
+func (w *wheelIndex) unschedule(t *timer) {
+	if t.slot != nil {
+		t.slot.Remove(t.elem)
+		t.slot, t.elem = nil, nil
+		w.counts[t.level]--
+	}
+}
+
+// skipTo returns the last tick that can be skipped without missing a
+// timer: nothing fires or cascades before the next boundary of the lowest
+// non empty level.
+func (w *wheelIndex) skipTo(target uint64) uint64 {
+	for level := 0; level < wheelLevels; level++ {
+		if w.counts[level] == 0 {
+			continue
+		}
+		if level == 0 {
+			return w.current
+		}
+		shift := uint(wheelBits * level)
+		boundary := ((w.current >> shift) + 1) << shift
+		if boundary-1 < target {
+			return boundary - 1
+		}
+		return target
+	}
+	return target
+}
+
+// collect advances the wheel up to now, cascading the timers of the upper
+// levels down as their slot comes up.
+func (w *wheelIndex) collect(now time.Time) []*timer {
+	var due []*timer
+	target := uint64(0)
+	if d := now.Sub(w.start); d > 0 {
+		target = uint64(d / w.tick)
+	}
+	for w.current < target {
+		if skip := w.skipTo(target); skip > w.current {
+			w.current = skip
+			continue
+		}
+		w.current++
+		for level := 1; level < wheelLevels; level++ {
+			if w.current&(1<<(wheelBits*level)-1) != 0 {
+				break
+			}
+			w.cascade(w.levels[level][(w.current>>(wheelBits*level))&wheelMask])
+		}
+		slot := w.levels[0][w.current&wheelMask]
+		for e := slot.Front(); e != nil; e = slot.Front() {
+			t := e.Value.(*timer)
+			w.unschedule(t)
+			if t.at.After(now) {
+				w.insert(t, w.current+1)
+				continue
+			}
+			due = append(due, t)
+		}
+	}
+	return due
+}
+
+func (w *wheelIndex) cascade(slot *list.List) {
+	for e := slot.Front(); e != nil; e = slot.Front() {
+		t := e.Value.(*timer)
+		w.unschedule(t)
+		w.insert(t, w.current)
+	}
+}